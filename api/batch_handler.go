@@ -0,0 +1,240 @@
+// Package api 提供API服务相关功能
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sign_agent/task"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchRequest 批量执行任务的请求
+type BatchRequest struct {
+	SecureKey string `json:"secure_key"`
+	// Tasks 要执行的任务，格式与 /api/task/execute 的请求体相同，其中的secure_key不使用
+	Tasks []TaskRequest `json:"tasks"`
+	// Concurrency 同时执行的任务数，0表示使用配置中的batch.concurrency，不能超过它
+	Concurrency int `json:"concurrency,omitempty"`
+	// Stream 为true时每个任务结束后立即以一行JSON返回它的结果，不等待所有任务结束
+	Stream bool `json:"stream,omitempty"`
+}
+
+// BatchItemResult 批量执行中一个任务的结果
+type BatchItemResult struct {
+	// Index 任务在请求中的序号，从0开始
+	Index int `json:"index"`
+	// Status 单独通过 /api/task/execute 执行该任务时的HTTP状态码
+	Status int `json:"status"`
+	Response
+}
+
+// hostLimiter 限制所有批量请求中同时请求同一主机的任务数
+type hostLimiter struct {
+	perHost int
+	hosts   map[string]int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// newHostLimiter 创建主机并发限制，perHost为默认的限制，hosts按主机名单独设置，0表示不限制
+func newHostLimiter(perHost int, hosts map[string]int) *hostLimiter {
+	l := &hostLimiter{
+		perHost: perHost,
+		hosts:   make(map[string]int, len(hosts)),
+		slots:   make(map[string]chan struct{}),
+	}
+	for host, n := range hosts {
+		l.hosts[strings.ToLower(host)] = n
+	}
+	return l
+}
+
+// slot 返回主机的并发信号量，不限制时返回nil
+func (l *hostLimiter) slot(host string) chan struct{} {
+	n := l.perHost
+	if v, ok := l.hosts[host]; ok {
+		n = v
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch, ok := l.slots[host]
+	if !ok {
+		ch = make(chan struct{}, n)
+		l.slots[host] = ch
+	}
+	return ch
+}
+
+// acquire 占用任务要请求的各主机的并发数。按主机名顺序占用，请求多个主机的任务之间不会相互等待；
+// ctx结束时释放已占用的并返回错误
+func (l *hostLimiter) acquire(ctx context.Context, hosts []string) (func(), error) {
+	sorted := append([]string(nil), hosts...)
+	sort.Strings(sorted)
+
+	var held []chan struct{}
+	release := func() {
+		for _, ch := range held {
+			<-ch
+		}
+	}
+	for _, host := range sorted {
+		ch := l.slot(host)
+		if ch == nil {
+			continue
+		}
+		select {
+		case ch <- struct{}{}:
+			held = append(held, ch)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// handleBatchTask 批量执行任务，按配置限制同时执行的任务数和同一主机的任务数。
+// 默认在所有任务结束后按请求中的顺序返回结果；stream为true时每个任务结束后立即返回一行JSON
+func (s *Server) handleBatchTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "仅支持POST请求",
+		})
+		return
+	}
+
+	var batch BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: fmt.Sprintf("无法解析请求体: %v", err),
+		})
+		return
+	}
+
+	var message string
+	maxTasks := s.config.Batch.MaxTasks
+	switch {
+	case len(batch.Tasks) == 0:
+		message = "tasks不能为空"
+	case len(batch.Tasks) > maxTasks:
+		message = fmt.Sprintf("一次最多执行%d个任务", maxTasks)
+	case batch.Concurrency < 0:
+		message = "concurrency不能为负数"
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: message,
+		})
+		return
+	}
+
+	concurrency := s.config.Batch.Concurrency
+	if batch.Concurrency > 0 && batch.Concurrency < concurrency {
+		concurrency = batch.Concurrency
+	}
+
+	// 控制端断开连接或agent停止时取消所有任务
+	ctx, cancel := s.taskContext(r.Context())
+	defer cancel()
+
+	results := make(chan BatchItemResult)
+	go s.runBatch(ctx, batch.Tasks, concurrency, results)
+
+	if batch.Stream {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		encoder := json.NewEncoder(w)
+		for item := range results {
+			encoder.Encode(item)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return
+	}
+
+	items := make([]BatchItemResult, len(batch.Tasks))
+	failed := 0
+	for item := range results {
+		items[item.Index] = item
+		if !item.Success {
+			failed++
+		}
+	}
+	resp := Response{
+		Success: failed == 0,
+		Data:    items,
+	}
+	if failed > 0 {
+		resp.Message = fmt.Sprintf("%d个任务中有%d个失败", len(items), failed)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runBatch 执行批量请求中的任务，每个任务结束后把结果发送到results，全部结束后关闭results
+func (s *Server) runBatch(ctx context.Context, tasks []TaskRequest, concurrency int, results chan<- BatchItemResult) {
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range tasks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results <- s.runBatchItem(ctx, i, &tasks[i], slots)
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+}
+
+// runBatchItem 等待主机和批量请求的并发数后执行一个任务。先占用主机的并发数，
+// 等待受限主机的任务不会占用批量请求的并发数
+func (s *Server) runBatchItem(ctx context.Context, index int, taskReq *TaskRequest, slots chan struct{}) BatchItemResult {
+	var hosts []string
+	if t, err := taskReq.task(); err == nil {
+		if ht, ok := t.(task.HostTask); ok {
+			hosts = ht.Hosts()
+		}
+	}
+
+	item := BatchItemResult{Index: index}
+	release, err := s.hosts.acquire(ctx, hosts)
+	if err != nil {
+		item.Status, item.Response = s.skipBatchItem(ctx, taskReq)
+		return item
+	}
+	defer release()
+
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+		item.Status, item.Response = s.executeTask(ctx, taskReq, sourceBatch)
+	case <-ctx.Done():
+		item.Status, item.Response = s.skipBatchItem(ctx, taskReq)
+	}
+	return item
+}
+
+// skipBatchItem 返回没有开始执行就被取消的任务的结果，同样保存执行记录
+func (s *Server) skipBatchItem(ctx context.Context, taskReq *TaskRequest) (int, Response) {
+	status, resp := interruptedResponse(ctx, taskReq, nil)
+	s.recordTask(taskReq, sourceBatch, time.Now(), resp)
+	return status, resp
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sign_agent/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestServer 在临时目录中使用默认配置创建API服务器，setup可以修改配置
+func newTestServer(t *testing.T, setup func(cfg *config.Config)) *Server {
+	t.Helper()
+	cfg, err := config.LoadConfig(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(cfg)
+	}
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop() })
+	return s
+}
+
+// curlTasks 返回依次请求 baseURL/0、baseURL/1…的curl任务
+func curlTasks(baseURL string, n int) []map[string]string {
+	tasks := make([]map[string]string, n)
+	for i := range tasks {
+		tasks[i] = map[string]string{"type": "curl", "command": fmt.Sprintf("curl %s/%d", baseURL, i)}
+	}
+	return tasks
+}
+
+// postBatch 向批量执行接口发送请求
+func postBatch(t *testing.T, url string, body interface{}) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// batchItem 批量执行结果中的一项，data为curl任务的结果
+type batchItem struct {
+	Index   int    `json:"index"`
+	Status  int    `json:"status"`
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    struct {
+		URL  string `json:"url"`
+		Body string `json:"body"`
+	} `json:"data"`
+}
+
+func TestBatchPerHostConcurrency(t *testing.T) {
+	const (
+		perHost = 2
+		tasks   = 8
+	)
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+	)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+
+		// 序号小的请求结束得晚，结果的完成顺序与请求中的顺序不同
+		var i int
+		fmt.Sscanf(r.URL.Path, "/%d", &i)
+		time.Sleep(time.Duration(tasks-i) * 10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		fmt.Fprintf(w, "task %d", i)
+	}))
+	defer target.Close()
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Batch.Concurrency = tasks
+		cfg.Batch.PerHost = perHost
+	})
+	agent := httptest.NewServer(http.HandlerFunc(s.handleBatchTask))
+	defer agent.Close()
+
+	resp := postBatch(t, agent.URL, map[string]interface{}{"tasks": curlTasks(target.URL, tasks)})
+	defer resp.Body.Close()
+	var out struct {
+		Success bool        `json:"success"`
+		Message string      `json:"message"`
+		Data    []batchItem `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !out.Success || len(out.Data) != tasks {
+		t.Fatalf("批量执行失败: %s, 返回%d个结果", out.Message, len(out.Data))
+	}
+	for i, item := range out.Data {
+		if item.Index != i || item.Status != http.StatusOK || item.Data.Body != fmt.Sprintf("task %d", i) {
+			t.Errorf("第%d个结果: %+v", i, item)
+		}
+	}
+	if peak > perHost {
+		t.Errorf("同时请求同一主机%d个, 超过per_host=%d", peak, perHost)
+	}
+	if peak < perHost {
+		t.Errorf("同时请求同一主机最多%d个, 期望达到per_host=%d", peak, perHost)
+	}
+}
+
+// stream为true时每个任务结束后立即返回一行结果，不等待其他任务
+func TestBatchStream(t *testing.T) {
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/0" {
+			<-release
+		}
+		fmt.Fprintf(w, "task %s", strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer target.Close()
+	defer close(release)
+
+	s := newTestServer(t, nil)
+	agent := httptest.NewServer(http.HandlerFunc(s.handleBatchTask))
+	defer agent.Close()
+
+	resp := postBatch(t, agent.URL, map[string]interface{}{"tasks": curlTasks(target.URL, 3), "stream": true})
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() batchItem {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("读取结果失败: %v", lines.Err())
+		}
+		var item batchItem
+		if err := json.Unmarshal(lines.Bytes(), &item); err != nil {
+			t.Fatalf("无法解析结果 %q: %v", lines.Text(), err)
+		}
+		return item
+	}
+
+	// 第0个任务阻塞时先收到其他任务的结果
+	seen := make(map[int]bool)
+	for i := 0; i < 2; i++ {
+		item := next()
+		if item.Index == 0 {
+			t.Fatal("第0个任务结束前收到了它的结果")
+		}
+		if !item.Success || item.Data.Body != fmt.Sprintf("task %d", item.Index) {
+			t.Errorf("第%d个结果: %+v", item.Index, item)
+		}
+		seen[item.Index] = true
+	}
+	if !seen[1] || !seen[2] {
+		t.Errorf("收到的结果 %v", seen)
+	}
+
+	release <- struct{}{}
+	if item := next(); item.Index != 0 || !item.Success || item.Data.Body != "task 0" {
+		t.Errorf("第0个结果: %+v", item)
+	}
+	if lines.Scan() {
+		t.Errorf("多余的结果: %s", lines.Text())
+	}
+}
@@ -0,0 +1,150 @@
+// Package api 提供API服务相关功能
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sign_agent/history"
+	"sign_agent/task"
+	"strconv"
+	"time"
+)
+
+// 执行记录中任务的来源
+const (
+	sourceExecute  = "execute"  // POST /api/task/execute
+	sourceSubmit   = "submit"   // POST /api/task/submit
+	sourceBatch    = "batch"    // POST /api/task/batch
+	sourceSchedule = "schedule" // agent上的定时任务
+)
+
+// recordTask 保存任务的执行记录。命令和结果中的凭据被隐藏，保存失败不影响任务的结果
+func (s *Server) recordTask(taskReq *TaskRequest, source string, start time.Time, resp Response) {
+	finish := time.Now()
+	rec := &history.Record{
+		Type:       taskReq.typeName(),
+		Source:     source,
+		Command:    redactCommand(taskReq),
+		Tags:       taskReq.Tags,
+		Status:     task.OutcomeSuccess,
+		Message:    resp.Message,
+		StartedAt:  start,
+		FinishedAt: finish,
+		DurationMs: math.Round(float64(finish.Sub(start))/float64(time.Millisecond)*100) / 100,
+	}
+	switch {
+	case resp.Outcome != nil:
+		rec.Status = resp.Outcome.Status
+	case !resp.Success:
+		rec.Status = task.OutcomeFailed
+	}
+	// 默认只保存结果分类和消息，不保存响应头、响应体等结构化结果；保存时隐藏其中的cookie和认证头
+	saved := resp
+	if !s.config.History.SaveResult {
+		saved.Data = nil
+	}
+	if data, err := json.Marshal(saved); err == nil {
+		if data, err = task.RedactResult(data); err == nil {
+			rec.Result = data
+		}
+	}
+
+	if err := s.history.Add(rec); err != nil {
+		log.Printf("保存执行记录失败: %v", err)
+	}
+}
+
+// redactCommand 返回保存在执行记录中的命令，请求无法解析时为空
+func redactCommand(taskReq *TaskRequest) string {
+	t, err := taskReq.task()
+	if err != nil {
+		return ""
+	}
+	return t.Redacted()
+}
+
+// handleTaskHistory 分页查询执行记录，支持按时间范围、任务类型、结果分类和标签筛选
+func (s *Server) handleTaskHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "仅支持GET请求",
+		})
+		return
+	}
+
+	query, err := parseHistoryQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	page, err := s.history.Query(query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: fmt.Sprintf("查询执行记录失败: %v", err),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// parseHistoryQuery 解析查询参数：from、to（RFC 3339时间或Unix时间戳），
+// type、status、tag，以及page、page_size
+func parseHistoryQuery(values url.Values) (history.Query, error) {
+	q := history.Query{
+		Status: values.Get("status"),
+		Tag:    values.Get("tag"),
+	}
+	// 名称和数字别名查询到相同的记录，包括旧版本按别名保存的记录
+	if name := values.Get("type"); name != "" {
+		q.Types = []string{name}
+		if taskType, ok := task.Lookup(name); ok {
+			q.Types = append([]string{taskType.Name}, taskType.Aliases...)
+		}
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(values.Get("from")); err != nil {
+		return q, fmt.Errorf("无效的from: %v", err)
+	}
+	if q.To, err = parseTimeParam(values.Get("to")); err != nil {
+		return q, fmt.Errorf("无效的to: %v", err)
+	}
+	for name, target := range map[string]*int{"page": &q.Page, "page_size": &q.PageSize} {
+		if v := values.Get(name); v != "" {
+			if *target, err = strconv.Atoi(v); err != nil || *target <= 0 {
+				return q, fmt.Errorf("无效的%s: %s", name, v)
+			}
+		}
+	}
+	return q, nil
+}
+
+// parseTimeParam 解析RFC 3339时间或Unix时间戳（秒），为空时返回零值
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
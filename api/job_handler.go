@@ -0,0 +1,151 @@
+// Package api 提供API服务相关功能
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sign_agent/job"
+	"strings"
+	"time"
+)
+
+// handleSubmitTask 提交异步任务，立即返回任务ID，通过 GET /api/task/{id} 查询结果
+func (s *Server) handleSubmitTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "仅支持POST请求",
+		})
+		return
+	}
+
+	var taskReq TaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&taskReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: fmt.Sprintf("无法解析请求体: %v", err),
+		})
+		return
+	}
+	if err := taskReq.validate(s.maxTimeout()); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	submitted, err := s.submitTask(&taskReq, sourceSubmit)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: fmt.Sprintf("提交任务失败: %v", err),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Data:    submitted,
+	})
+}
+
+// submitTask 把任务加入异步任务队列，source为执行记录中任务的来源
+func (s *Server) submitTask(taskReq *TaskRequest, source string) (*job.Job, error) {
+	return s.jobs.Submit(taskReq.Type, func(ctx context.Context) (interface{}, error) {
+		_, resp := s.executeTask(ctx, taskReq, source)
+		if !resp.Success {
+			return resp, errors.New(resp.Message)
+		}
+		return resp, nil
+	})
+}
+
+// handleTaskJob 处理 /api/task/{id}：GET查询异步任务的状态和结果，DELETE取消任务
+func (s *Server) handleTaskJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/task/")
+	if id == "" || strings.Contains(id, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "未知的接口",
+		})
+		return
+	}
+
+	var j *job.Job
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		j, err = s.jobs.Get(id)
+	case http.MethodDelete:
+		j, err = s.jobs.Cancel(id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "仅支持GET和DELETE请求",
+		})
+		return
+	}
+
+	switch {
+	case errors.Is(err, job.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, job.ErrFinished):
+		w.WriteHeader(http.StatusConflict)
+	}
+	if err != nil {
+		resp := Response{
+			Success: false,
+			Message: err.Error(),
+		}
+		// 已结束的任务不能取消，同时返回它的状态
+		if j != nil {
+			resp.Data = j
+		}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Data:    j,
+	})
+}
+
+// validate 在异步任务排队前检查请求，避免提交后才发现任务类型或参数无效
+func (req *TaskRequest) validate(maxTimeout time.Duration) error {
+	if err := req.checkTimeout(maxTimeout); err != nil {
+		return err
+	}
+	t, err := req.task()
+	if err != nil {
+		return err
+	}
+	return t.Validate()
+}
+
+// checkTimeout 检查timeout_ms，不能为负数，也不能超过配置的任务超时时间上限
+func (req *TaskRequest) checkTimeout(maxTimeout time.Duration) error {
+	if req.TimeoutMs < 0 {
+		return fmt.Errorf("timeout_ms不能为负数")
+	}
+	// 按毫秒比较，超大的值转换为time.Duration时会溢出
+	if limit := maxTimeout.Milliseconds(); req.TimeoutMs > limit {
+		return fmt.Errorf("timeout_ms不能超过%d（curl.max_timeout）", limit)
+	}
+	return nil
+}
@@ -2,13 +2,25 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 )
 
 // handleAuthMiddleware 中间件：验证安全密钥
 func (s *Server) handleAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// 限制请求体大小，声明的长度超过上限时直接拒绝，未声明长度时在读取超过上限时拒绝
+		limit := int64(s.config.MaxRequestKB) << 10
+		if r.ContentLength > limit {
+			writeRequestTooLarge(w, limit)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
 		// 获取请求头中的安全密钥
 		secureKey := r.Header.Get("X-Secure-Key")
 		if secureKey == "" {
@@ -19,15 +31,28 @@ func (s *Server) handleAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 				}
 
 				if secureKey == "" && r.Header.Get("Content-Type") == "application/json" {
+					// 读取后重新设置body以便后续处理
+					body, err := io.ReadAll(r.Body)
+					if err != nil {
+						var maxBytesErr *http.MaxBytesError
+						if errors.As(err, &maxBytesErr) {
+							writeRequestTooLarge(w, limit)
+						} else {
+							w.WriteHeader(http.StatusBadRequest)
+							json.NewEncoder(w).Encode(Response{
+								Success: false,
+								Message: fmt.Sprintf("读取请求体失败: %v", err),
+							})
+						}
+						return
+					}
 					var data map[string]interface{}
-					decoder := json.NewDecoder(r.Body)
-					if err := decoder.Decode(&data); err == nil {
+					if err := json.Unmarshal(body, &data); err == nil {
 						if key, ok := data["secure_key"].(string); ok {
 							secureKey = key
 						}
 					}
-					// 由于我们已经读取了body，需要重新设置它以便后续处理
-					r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 限制请求体大小为1MB
+					r.Body = io.NopCloser(bytes.NewReader(body))
 				}
 			}
 		}
@@ -45,3 +70,13 @@ func (s *Server) handleAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// writeRequestTooLarge 返回请求体超过大小上限的响应
+func writeRequestTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Message: fmt.Sprintf("请求体超过%dKB的上限", limit>>10),
+	})
+}
@@ -0,0 +1,179 @@
+// Package api 提供API服务相关功能
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sign_agent/schedule"
+	"time"
+)
+
+// ScheduleInfo 定时任务列表中的一项，任务只返回隐藏了凭据的摘要
+type ScheduleInfo struct {
+	schedule.Status
+	Task ScheduledTaskSummary `json:"task"`
+}
+
+// ScheduledTaskSummary 定时任务要执行的任务的摘要
+type ScheduledTaskSummary struct {
+	Type    string   `json:"type"`
+	Command string   `json:"command"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// parseScheduledTask 解析并检查定时任务中的任务。任务中的安全密钥会被去掉，
+// 保存到定时任务文件中的任务不包含agent的安全密钥
+func parseScheduledTask(sch *schedule.Schedule, maxTimeout time.Duration) (*TaskRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(sch.Task, &fields); err != nil {
+		return nil, fmt.Errorf("定时任务 %s 的任务无法解析: %v", sch.Name, err)
+	}
+	if _, ok := fields["secure_key"]; ok {
+		delete(fields, "secure_key")
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		sch.Task = data
+	}
+
+	var taskReq TaskRequest
+	if err := json.Unmarshal(sch.Task, &taskReq); err != nil {
+		return nil, fmt.Errorf("定时任务 %s 的任务无法解析: %v", sch.Name, err)
+	}
+	if err := taskReq.validate(maxTimeout); err != nil {
+		return nil, fmt.Errorf("定时任务 %s 的任务无效: %v", sch.Name, err)
+	}
+	return &taskReq, nil
+}
+
+// runSchedule 把到期的定时任务加入异步任务队列，和异步任务共用worker，
+// 执行记录的来源为schedule，并带有 schedule:名称 标签
+func (s *Server) runSchedule(sch *schedule.Schedule) (string, error) {
+	taskReq, err := parseScheduledTask(sch, s.maxTimeout())
+	if err != nil {
+		return "", err
+	}
+	taskReq.Tags = append(taskReq.Tags, "schedule:"+sch.Name)
+
+	submitted, err := s.submitTask(taskReq, sourceSchedule)
+	if err != nil {
+		// 没有进入队列的任务也保存执行记录，便于发现定时任务没有执行
+		s.recordTask(taskReq, sourceSchedule, time.Now(), Response{
+			Success: false,
+			Message: fmt.Sprintf("提交任务失败: %v", err),
+		})
+		return "", err
+	}
+	return submitted.ID, nil
+}
+
+// scheduleInfo 把定时任务的状态转换为接口返回的格式
+func scheduleInfo(st schedule.Status) ScheduleInfo {
+	info := ScheduleInfo{Status: st}
+	var taskReq TaskRequest
+	if err := json.Unmarshal(st.Task, &taskReq); err == nil {
+		info.Task = ScheduledTaskSummary{
+			Type:    taskReq.Type,
+			Command: redactCommand(&taskReq),
+			Tags:    taskReq.Tags,
+		}
+	}
+	return info
+}
+
+// handleSchedules 管理定时任务：GET列出所有定时任务及下一次执行时间，
+// POST注册或更新定时任务，DELETE删除通过API注册的定时任务
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		list := s.schedules.List()
+		infos := make([]ScheduleInfo, len(list))
+		for i, st := range list {
+			infos[i] = scheduleInfo(st)
+		}
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Data:    infos,
+		})
+
+	case http.MethodPost:
+		var sch schedule.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&sch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("无法解析请求体: %v", err),
+			})
+			return
+		}
+		if err := sch.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		if _, err := parseScheduledTask(&sch, s.maxTimeout()); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		st, err := s.schedules.Put(sch)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, schedule.ErrReadOnly) {
+				status = http.StatusConflict
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("保存定时任务失败: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: fmt.Sprintf("定时任务 %s 已保存", sch.Name),
+			Data:    scheduleInfo(st),
+		})
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if err := s.schedules.Delete(name); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, schedule.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, schedule.ErrReadOnly):
+				status = http.StatusConflict
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("删除定时任务失败: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: fmt.Sprintf("定时任务 %s 已删除", name),
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "仅支持GET、POST和DELETE请求",
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package api 提供API服务相关功能
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sign_agent/vault"
+)
+
+// SecretRequest 保存密钥的请求
+type SecretRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// handleSecrets 管理密钥库：GET列出密钥名称，POST保存密钥，DELETE删除密钥。
+// 响应中只包含密钥名称，不会返回密钥的值
+func (s *Server) handleSecrets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		names, err := s.vault.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("读取密钥库失败: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Data:    names,
+		})
+
+	case http.MethodPost:
+		var req SecretRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("无法解析请求体: %v", err),
+			})
+			return
+		}
+		if err := s.vault.Put(req.Name, req.Value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("保存密钥失败: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: fmt.Sprintf("密钥 %s 已保存", req.Name),
+		})
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if err := s.vault.Delete(name); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, vault.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(Response{
+				Success: false,
+				Message: fmt.Sprintf("删除密钥失败: %v", err),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(Response{
+			Success: true,
+			Message: fmt.Sprintf("密钥 %s 已删除", name),
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Message: "仅支持GET、POST和DELETE请求",
+		})
+	}
+}
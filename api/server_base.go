@@ -2,26 +2,134 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"sign_agent/config"
+	"sign_agent/history"
+	"sign_agent/job"
+	"sign_agent/schedule"
+	"sign_agent/task"
+	"sign_agent/vault"
+	"time"
 )
 
 // Server 结构体是从原始server.go移动过来的
 
+// shutdownTimeout 停止时等待正在处理的请求返回的最长时间
+const shutdownTimeout = 5 * time.Second
+
 // Server API服务器结构体
 type Server struct {
-	config *config.Config
-	server *http.Server
+	config    *config.Config
+	server    *http.Server
+	vault     *vault.Vault
+	jobs      *job.Manager
+	history   *history.Store
+	schedules *schedule.Scheduler
+	// hosts 批量执行时按主机限制并发
+	hosts *hostLimiter
+
+	// ctx 在Stop时取消，用于中止正在同步执行的任务
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewServer 创建一个新的API服务器
-func NewServer(cfg *config.Config) *Server {
-	return &Server{
-		config: cfg,
+func NewServer(cfg *config.Config) (*Server, error) {
+	// 应用任务相关配置
+	task.SetCurlOptions(task.CurlOptions{
+		FileDir:     cfg.ResolvePath(cfg.Curl.FileDir),
+		CookieDir:   cfg.ResolvePath(cfg.Curl.CookieDir),
+		MaxTimeout:  time.Duration(cfg.Curl.MaxTimeout) * time.Second,
+		Proxy:       cfg.Curl.Proxy,
+		NoProxy:     cfg.Curl.NoProxy,
+		CertDir:     cfg.ResolvePath(cfg.Curl.CertDir),
+		MaxBodySize: int64(cfg.Curl.MaxBodyMB) << 20,
+	})
+	task.SetNodeOptions(task.NodeOptions{
+		Binary:      cfg.Node.Binary,
+		WorkDir:     cfg.ResolvePath(cfg.Node.WorkDir),
+		Timeout:     time.Duration(cfg.Node.Timeout) * time.Second,
+		MaxMemoryMB: cfg.Node.MaxMemoryMB,
+		MaxOutput:   cfg.Node.MaxOutputKB << 10,
+	})
+	task.SetPythonOptions(task.PythonOptions{
+		Binary:         cfg.Python.Binary,
+		VenvDir:        cfg.ResolvePath(cfg.Python.VenvDir),
+		WorkDir:        cfg.ResolvePath(cfg.Python.WorkDir),
+		Timeout:        time.Duration(cfg.Python.Timeout) * time.Second,
+		InstallTimeout: time.Duration(cfg.Python.InstallTimeout) * time.Second,
+		MaxMemoryMB:    cfg.Python.MaxMemoryMB,
+		MaxOutput:      cfg.Python.MaxOutputKB << 10,
+	})
+	task.SetJSOptions(task.JSOptions{
+		Timeout:     time.Duration(cfg.JS.Timeout) * time.Second,
+		MaxMemoryMB: cfg.JS.MaxMemoryMB,
+		MaxOutput:   cfg.JS.MaxOutputKB << 10,
+	})
+	totpSecrets := make(map[string]task.TOTPOptions, len(cfg.TOTP))
+	for name, totp := range cfg.TOTP {
+		totpSecrets[name] = task.TOTPOptions{
+			SecretName: totp.SecretName,
+			Digits:     totp.Digits,
+			Period:     time.Duration(totp.Period) * time.Second,
+			Algorithm:  totp.Algorithm,
+		}
 	}
+	task.SetTOTPSecrets(totpSecrets)
+
+	secrets := vault.New(cfg.ResolvePath(cfg.Vault.File), cfg.ResolvePath(cfg.Vault.KeyFile), os.Getenv(vault.PassphraseEnv))
+	task.SetSecretStore(secrets)
+
+	records, err := history.Open(cfg.ResolvePath(cfg.History.File), history.Options{
+		MaxAge:        time.Duration(cfg.History.MaxAgeDays) * 24 * time.Hour,
+		MaxSize:       int64(cfg.History.MaxSizeMB) << 20,
+		MaxResultSize: cfg.History.MaxResultKB << 10,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("打开执行记录失败: %v", err)
+	}
+
+	s := &Server{
+		config:  cfg,
+		vault:   secrets,
+		history: records,
+		hosts:   newHostLimiter(cfg.Batch.PerHost, cfg.Batch.Hosts),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	// 配置文件中的定时任务在启动时检查，任务无效时拒绝启动
+	static := make([]schedule.Schedule, len(cfg.Schedule.Tasks))
+	for i, t := range cfg.Schedule.Tasks {
+		static[i] = schedule.Schedule{
+			Name:     t.Name,
+			Cron:     t.Cron,
+			Timezone: t.Timezone,
+			Missed:   t.Missed,
+			Task:     t.Task,
+		}
+		if err := static[i].Validate(); err != nil {
+			return nil, fmt.Errorf("定时任务配置无效: %v", err)
+		}
+		if _, err := parseScheduledTask(&static[i], s.maxTimeout()); err != nil {
+			return nil, fmt.Errorf("定时任务配置无效: %v", err)
+		}
+	}
+	s.schedules, err = schedule.New(cfg.ResolvePath(cfg.Schedule.File), static, s.runSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("加载定时任务失败: %v", err)
+	}
+
+	s.jobs = job.NewManager(job.Options{
+		Workers:   cfg.Jobs.Workers,
+		QueueSize: cfg.Jobs.QueueSize,
+		Retention: time.Duration(cfg.Jobs.Retention) * time.Second,
+	})
+	return s, nil
 }
 
 // Start 启动API服务
@@ -31,6 +139,13 @@ func (s *Server) Start() error {
 	// 注册API路由
 	mux.HandleFunc("/api/system/info", s.handleAuthMiddleware(s.handleSystemInfo))
 	mux.HandleFunc("/api/task/execute", s.handleAuthMiddleware(s.handleExecuteTask))
+	mux.HandleFunc("/api/task/submit", s.handleAuthMiddleware(s.handleSubmitTask))
+	mux.HandleFunc("/api/task/batch", s.handleAuthMiddleware(s.handleBatchTask))
+	mux.HandleFunc("/api/task/history", s.handleAuthMiddleware(s.handleTaskHistory))
+	mux.HandleFunc("/api/task/types", s.handleAuthMiddleware(s.handleTaskTypes))
+	mux.HandleFunc("/api/task/", s.handleAuthMiddleware(s.handleTaskJob))
+	mux.HandleFunc("/api/secrets", s.handleAuthMiddleware(s.handleSecrets))
+	mux.HandleFunc("/api/schedules", s.handleAuthMiddleware(s.handleSchedules))
 	mux.HandleFunc("/api/health", s.handleHealth)
 
 	addr := fmt.Sprintf(":%d", s.config.GetPort())
@@ -39,16 +154,32 @@ func (s *Server) Start() error {
 		Handler: mux,
 	}
 
+	// 开始调度定时任务，首次检查时处理agent未运行期间错过的执行
+	s.schedules.Start()
+
 	log.Printf("API服务启动，监听地址: %s\n", addr)
-	return s.server.ListenAndServe()
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 // Stop 停止API服务
 func (s *Server) Stop() error {
+	// 先中止同步执行中的任务，等待它们返回取消的响应后再关闭连接
+	s.cancel()
+	var err error
 	if s.server != nil {
-		return s.server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if s.server.Shutdown(ctx) != nil {
+			err = s.server.Close()
+		}
 	}
-	return nil
+	// 停止调度定时任务，再取消排队和执行中的异步任务
+	s.schedules.Stop()
+	s.jobs.Stop()
+	return err
 }
 
 // 健康检查端点
@@ -49,11 +49,14 @@ func (s *Server) handleSystemInfo(w http.ResponseWriter, r *http.Request) {
 	// CPU使用率保留两位小数
 	cpuUsage = math.Round(cpuUsage*100) / 100
 
+	jobStats := s.jobs.Stats()
 	sysInfo := SystemInfo{
 		TotalMemoryMB:   int(totalMemoryMB),
 		UsedMemoryMB:    int(usedMemoryMB),
 		MemoryUsagePerc: memoryUsagePerc,
 		CPUUsagePerc:    cpuUsage,
+		QueueLength:     jobStats.Queued,
+		RunningTasks:    jobStats.Running,
 	}
 
 	json.NewEncoder(w).Encode(Response{
@@ -2,10 +2,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sign_agent/task"
+	"time"
 )
 
 // handleExecuteTask 处理任务执行请求
@@ -32,39 +34,128 @@ func (s *Server) handleExecuteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch taskReq.Type {
-	case "1": // curl命令执行
-		result, err := task.ExecuteCurlCommand(taskReq.Command)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(Response{
-				Success: false,
-				Message: fmt.Sprintf("执行curl命令失败: %v", err),
-			})
-			return
+	// 控制端断开连接或agent停止时取消任务
+	ctx, cancel := s.taskContext(r.Context())
+	defer cancel()
+
+	status, resp := s.executeTask(ctx, &taskReq, sourceExecute)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// taskContext 返回同步执行的任务使用的上下文，parent结束或agent停止时取消
+func (s *Server) taskContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(s.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// executeTask 执行任务并保存执行记录，返回HTTP状态码和响应。同步执行和异步任务共用，
+// source为执行记录中任务的来源，ctx取消时中止任务
+func (s *Server) executeTask(ctx context.Context, taskReq *TaskRequest, source string) (int, Response) {
+	start := time.Now()
+	if err := taskReq.checkTimeout(s.maxTimeout()); err != nil {
+		resp := Response{
+			Success: false,
+			Message: err.Error(),
 		}
+		s.recordTask(taskReq, source, start, resp)
+		return http.StatusBadRequest, resp
+	}
+	if taskReq.TimeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(taskReq.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+	status, resp := s.runTask(ctx, taskReq)
+	s.recordTask(taskReq, source, start, resp)
+	return status, resp
+}
 
-		json.NewEncoder(w).Encode(Response{
-			Success: true,
-			Data:    result,
-		})
+// maxTimeout 返回任务超时时间的上限，请求中的timeout_ms不能超过它
+func (s *Server) maxTimeout() time.Duration {
+	return time.Duration(s.config.Curl.MaxTimeout) * time.Second
+}
 
-	case "2": // 预留给Node.js执行
-		json.NewEncoder(w).Encode(Response{
+// runTask 按任务类型执行任务，返回HTTP状态码和响应
+func (s *Server) runTask(ctx context.Context, taskReq *TaskRequest) (int, Response) {
+	if _, ok := task.Lookup(taskReq.Type); !ok {
+		return http.StatusOK, Response{
 			Success: false,
-			Message: "Node.js命令执行功能尚未实现",
-		})
+			Message: fmt.Sprintf("不支持的任务类型: %s", taskReq.Type),
+		}
+	}
+	t, err := taskReq.task()
+	if err != nil {
+		return http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
 
-	case "3": // 预留给Python执行
-		json.NewEncoder(w).Encode(Response{
+	result, err := t.Execute(ctx)
+	// 任务被取消或超时时，不论任务返回什么都按错误码报告，已得到的部分结果保留在data中
+	if ctx.Err() != nil {
+		return interruptedResponse(ctx, taskReq, result)
+	}
+	if err != nil {
+		return http.StatusBadRequest, Response{
 			Success: false,
-			Message: "Python命令执行功能尚未实现",
-		})
+			Message: err.Error(),
+		}
+	}
 
-	default:
+	resp := Response{
+		Success: result.Failure == nil,
+		Data:    result.Data,
+		Outcome: result.Outcome,
+	}
+	if result.Failure != nil {
+		resp.Message = result.Failure.Error()
+	}
+	return http.StatusOK, resp
+}
+
+// interruptedResponse 任务被取消或超时时的响应。超时返回504，取消返回503
+func interruptedResponse(ctx context.Context, taskReq *TaskRequest, result *task.Result) (int, Response) {
+	status, resp := http.StatusServiceUnavailable, Response{
+		Success: false,
+		Message: "任务已取消",
+		Code:    CodeCancelled,
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		status, resp = http.StatusGatewayTimeout, Response{
+			Success: false,
+			Message: fmt.Sprintf("任务执行超时（%dms）", taskReq.TimeoutMs),
+			Code:    CodeTimeout,
+		}
+	}
+	if result != nil {
+		resp.Data = result.Data
+	}
+	return status, resp
+}
+
+// handleTaskTypes 列出agent支持的任务类型，包括参数和结果的JSON Schema
+func (s *Server) handleTaskTypes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(Response{
 			Success: false,
-			Message: fmt.Sprintf("不支持的任务类型: %s", taskReq.Type),
+			Message: "仅支持GET请求",
 		})
+		return
 	}
+
+	json.NewEncoder(w).Encode(Response{
+		Success: true,
+		Data:    task.Types(),
+	})
 }
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sign_agent/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMsLimit(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Curl.MaxTimeout = 300 })
+	execute := httptest.NewServer(http.HandlerFunc(s.handleExecuteTask))
+	defer execute.Close()
+	submit := httptest.NewServer(http.HandlerFunc(s.handleSubmitTask))
+	defer submit.Close()
+
+	tests := []struct {
+		timeoutMs int64
+		ok        bool
+	}{
+		{0, true},
+		{300000, true},
+		{300001, false},
+		// 转换为time.Duration时会溢出的值
+		{math.MaxInt64 / int64(time.Millisecond) * 2, false},
+		{math.MaxInt64, false},
+		{-1, false},
+	}
+	for _, tt := range tests {
+		for _, url := range []string{execute.URL, submit.URL} {
+			body, _ := json.Marshal(map[string]interface{}{
+				"type":       "curl",
+				"command":    "curl " + target.URL,
+				"timeout_ms": tt.timeoutMs,
+			})
+			resp, err := http.Post(url, "application/json", strings.NewReader(string(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out Response
+			json.NewDecoder(resp.Body).Decode(&out)
+			resp.Body.Close()
+
+			if tt.ok {
+				if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+					t.Errorf("timeout_ms=%d: 状态码 %d, %s", tt.timeoutMs, resp.StatusCode, out.Message)
+				}
+				continue
+			}
+			if resp.StatusCode != http.StatusBadRequest || !strings.Contains(out.Message, "timeout_ms") {
+				t.Errorf("timeout_ms=%d: 状态码 %d, %s, 期望400", tt.timeoutMs, resp.StatusCode, out.Message)
+			}
+		}
+	}
+}
@@ -1,6 +1,12 @@
 // Package api 提供API服务相关功能
 package api
 
+import (
+	"encoding/json"
+	"fmt"
+	"sign_agent/task"
+)
+
 // 类型定义部分，这些类型是从原始server.go文件移动过来的
 
 // SystemInfo 系统信息结构体
@@ -9,18 +15,69 @@ type SystemInfo struct {
 	UsedMemoryMB    int     `json:"used_memory_mb"`
 	MemoryUsagePerc float64 `json:"memory_usage_perc"`
 	CPUUsagePerc    float64 `json:"cpu_usage_perc"`
+	// QueueLength 排队等待执行的异步任务数，RunningTasks 正在执行的异步任务数
+	QueueLength  int `json:"queue_length"`
+	RunningTasks int `json:"running_tasks"`
 }
 
-// TaskRequest 任务执行请求结构体
+// TaskRequest 任务执行请求结构体。type、secure_key、tags和timeout_ms以外的字段是任务类型的参数，
+// 由type对应的任务类型解析，各类型的参数见 GET /api/task/types
 type TaskRequest struct {
+	// Type 任务类型的名称（如curl）或数字别名（如"1"）
 	Type      string `json:"type"`
-	Command   string `json:"command"`
 	SecureKey string `json:"secure_key"`
+	// Tags 任务的标签（如账号名），保存在执行记录中用于查询
+	Tags []string `json:"tags,omitempty"`
+	// TimeoutMs 任务的最长执行时间（毫秒），超过时中止任务，0表示不限制
+	// （各任务类型仍受配置中的超时限制）
+	TimeoutMs int64 `json:"timeout_ms,omitempty"`
+
+	// params 完整的请求体，交给任务类型解析
+	params json.RawMessage
 }
 
+// UnmarshalJSON 解析通用字段，并保存完整的请求体供任务类型解析参数
+func (req *TaskRequest) UnmarshalJSON(data []byte) error {
+	type plain TaskRequest
+	if err := json.Unmarshal(data, (*plain)(req)); err != nil {
+		return err
+	}
+	req.params = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// task 按任务类型解析请求中的参数
+func (req *TaskRequest) task() (task.Task, error) {
+	taskType, ok := task.Lookup(req.Type)
+	if !ok {
+		return nil, fmt.Errorf("不支持的任务类型: %s", req.Type)
+	}
+	return taskType.Parse(req.params)
+}
+
+// typeName 返回任务类型的名称，数字别名转换为名称，未注册的类型原样返回
+func (req *TaskRequest) typeName() string {
+	if taskType, ok := task.Lookup(req.Type); ok {
+		return taskType.Name
+	}
+	return req.Type
+}
+
+// 任务没有执行完成时响应中的错误码
+const (
+	// CodeCancelled 控制端断开了连接、异步任务被取消或agent正在停止
+	CodeCancelled = "cancelled"
+	// CodeTimeout 超过了请求中的timeout_ms
+	CodeTimeout = "timeout"
+)
+
 // Response API响应结构体
 type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
+	// Code 任务被取消或超时时的错误码，见CodeCancelled、CodeTimeout
+	Code string `json:"code,omitempty"`
+	// Outcome curl和工作流任务按断言得到的结果分类，失败时success为false
+	Outcome *task.Outcome `json:"outcome,omitempty"`
 }
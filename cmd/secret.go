@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sign_agent/config"
+	"sign_agent/vault"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// SecretUsage secret子命令的用法说明
+const SecretUsage = `用法:
+  checkin-agent secret [--config 配置文件] put <名称>     从标准输入读取密钥的值并保存
+  checkin-agent secret [--config 配置文件] list           列出密钥名称
+  checkin-agent secret [--config 配置文件] delete <名称>  删除密钥`
+
+// Secret 执行secret子命令，管理agent上的加密密钥库
+func Secret(configPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少操作\n%s", SecretUsage)
+	}
+
+	// 加载配置
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %v", err)
+	}
+	secrets := vault.New(cfg.ResolvePath(cfg.Vault.File), cfg.ResolvePath(cfg.Vault.KeyFile), os.Getenv(vault.PassphraseEnv))
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names, err := secrets.List()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+
+	case args[0] == "put" && len(args) == 2:
+		if err := vault.ValidateName(args[1]); err != nil {
+			return err
+		}
+		value, err := readSecretValue()
+		if err != nil {
+			return err
+		}
+		if err := secrets.Put(args[1], value); err != nil {
+			return err
+		}
+		fmt.Printf("密钥 %s 已保存\n", args[1])
+		return nil
+
+	case args[0] == "delete" && len(args) == 2:
+		if err := secrets.Delete(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("密钥 %s 已删除\n", args[1])
+		return nil
+	}
+	return fmt.Errorf("无效的参数: %s\n%s", strings.Join(args, " "), SecretUsage)
+}
+
+// readSecretValue 从标准输入读取密钥的值，避免值出现在命令行参数和shell历史中。
+// 在终端中输入时关闭回显读取一行，通过管道输入时读取全部内容并去掉末尾的换行
+func readSecretValue() (string, error) {
+	var value string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "请输入密钥的值: ")
+		line, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("读取标准输入失败: %v", err)
+		}
+		value = string(line)
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("读取标准输入失败: %v", err)
+		}
+		value = string(data)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(value, "\n"), "\r"), nil
+}
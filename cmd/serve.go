@@ -19,7 +19,10 @@ func StartServer(configPath string) error {
 	}
 
 	// 创建API服务器
-	server := api.NewServer(cfg)
+	server, err := api.NewServer(cfg)
+	if err != nil {
+		return err
+	}
 
 	// 设置信号处理，优雅退出
 	sigCh := make(chan os.Signal, 1)
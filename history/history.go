@@ -0,0 +1,316 @@
+// Package history 提供任务执行记录的持久化存储与查询
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 按保留时长清理的最小间隔
+const pruneInterval = time.Hour
+
+// 单条记录的最大长度，读取时跳过更长的行
+const maxLineSize = 16 << 20
+
+// 分页查询的默认和最大每页条数
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Record 一次任务执行的记录
+type Record struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Source 任务的来源：execute（同步执行）、submit（异步任务）等
+	Source string `json:"source"`
+	// Command 隐藏了凭据的命令，脚本任务只记录摘要
+	Command string   `json:"command"`
+	Tags    []string `json:"tags,omitempty"`
+	// Status 结果分类：success、already_done或failed
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Result 任务的响应，超过长度上限时不保存并设置ResultTruncated
+	Result          json.RawMessage `json:"result,omitempty"`
+	ResultTruncated bool            `json:"result_truncated,omitempty"`
+	StartedAt       time.Time       `json:"started_at"`
+	FinishedAt      time.Time       `json:"finished_at"`
+	DurationMs      float64         `json:"duration_ms"`
+}
+
+// hasTag 记录是否包含标签
+func (r *Record) hasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Options 执行记录的保留策略
+type Options struct {
+	// MaxAge 记录的保留时长
+	MaxAge time.Duration
+	// MaxSize 记录文件的大小上限（字节），超过时删除最早的记录
+	MaxSize int64
+	// MaxResultSize 单条记录保存的响应长度上限（字节）
+	MaxResultSize int
+}
+
+// Query 查询条件，零值表示不限制
+type Query struct {
+	From, To time.Time
+	// Types 任务类型，记录的类型为其中之一即可（名称和兼容旧版本的数字别名）
+	Types  []string
+	Status string
+	Tag    string
+	// Page 从1开始的页码，PageSize 每页条数
+	Page     int
+	PageSize int
+}
+
+// Page 一页查询结果，按开始时间从新到旧排列
+type Page struct {
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+	Records  []*Record `json:"records"`
+}
+
+// Store 保存在JSON Lines文件中的执行记录。新记录追加到文件末尾，
+// 超过保留时长或大小上限时重写文件删除最早的记录
+type Store struct {
+	path string
+	opts Options
+
+	mu        sync.Mutex
+	size      int64
+	lastPrune time.Time
+}
+
+// Open 打开执行记录文件，文件不存在时在写入第一条记录时创建
+func Open(path string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %v", err)
+	}
+	s := &Store{path: path, opts: opts}
+
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取执行记录失败: %v", err)
+	}
+	if err == nil {
+		s.size = info.Size()
+	}
+	if err := s.compact(time.Now(), 0); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add 追加一条记录，ID为空时自动生成
+func (s *Store) Add(rec *Record) error {
+	if rec.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		rec.ID = id
+	}
+	if s.opts.MaxResultSize > 0 && len(rec.Result) > s.opts.MaxResultSize {
+		rec.Result = nil
+		rec.ResultTruncated = true
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("序列化执行记录失败: %v", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if (s.opts.MaxSize > 0 && s.size+int64(len(line)) > s.opts.MaxSize) || now.Sub(s.lastPrune) > pruneInterval {
+		if err := s.compact(now, int64(len(line))); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("写入执行记录失败: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("写入执行记录失败: %v", err)
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+// Query 按条件分页查询记录
+func (s *Store) Query(q Query) (*Page, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*Record
+	err := s.scan(func(rec *Record, _ []byte) {
+		switch {
+		case !q.From.IsZero() && rec.StartedAt.Before(q.From):
+		case !q.To.IsZero() && !rec.StartedAt.Before(q.To):
+		case len(q.Types) > 0 && !slices.Contains(q.Types, rec.Type):
+		case q.Status != "" && rec.Status != q.Status:
+		case q.Tag != "" && !rec.hasTag(q.Tag):
+		default:
+			matched = append(matched, rec)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].StartedAt.After(matched[j].StartedAt)
+	})
+	page := &Page{Total: len(matched), Page: q.Page, PageSize: q.PageSize, Records: []*Record{}}
+	// 先按页数比较再计算偏移，页码很大时相乘会溢出
+	if pages := (len(matched) + q.PageSize - 1) / q.PageSize; q.Page <= pages {
+		start := (q.Page - 1) * q.PageSize
+		end := start + q.PageSize
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Records = matched[start:end]
+	}
+	return page, nil
+}
+
+// scan 按写入顺序读取所有记录，跳过无法解析的行（如写入中断留下的不完整记录）
+func (s *Store) scan(fn func(rec *Record, line []byte)) error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取执行记录失败: %v", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64<<10)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && len(line) <= maxLineSize {
+			var rec Record
+			if json.Unmarshal(bytes.TrimSpace(line), &rec) == nil {
+				fn(&rec, line)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取执行记录失败: %v", err)
+		}
+	}
+}
+
+// compact 删除超过保留时长的记录；文件加上即将写入的reserve字节会超过大小上限时，
+// 再从最早的记录开始删除，直到文件不超过上限的3/4。调用方需要持有锁
+func (s *Store) compact(now time.Time, reserve int64) error {
+	s.lastPrune = now
+	limit := s.opts.MaxSize
+	if limit > 0 && s.size+reserve > limit {
+		limit = limit * 3 / 4
+	} else {
+		limit = 0
+	}
+
+	var kept [][]byte
+	var keptSize int64
+	expired := false
+	err := s.scan(func(rec *Record, line []byte) {
+		if s.opts.MaxAge > 0 && now.Sub(rec.FinishedAt) > s.opts.MaxAge {
+			expired = true
+			return
+		}
+		kept = append(kept, line)
+		keptSize += int64(len(line))
+	})
+	if err != nil {
+		return err
+	}
+	if !expired && limit == 0 {
+		return nil
+	}
+
+	for limit > 0 && len(kept) > 0 && keptSize+reserve > limit {
+		keptSize -= int64(len(kept[0]))
+		kept = kept[1:]
+	}
+
+	var buf bytes.Buffer
+	for _, line := range kept {
+		buf.Write(line)
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	if err := writeFile(s.path, buf.Bytes()); err != nil {
+		return err
+	}
+	s.size = int64(buf.Len())
+	return nil
+}
+
+// writeFile 先写入临时文件再替换，写入中断时不会丢失原有的记录
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("写入执行记录失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入执行记录失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入执行记录失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("写入执行记录失败: %v", err)
+	}
+	return nil
+}
+
+// newID 生成随机的记录ID
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,317 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// base 测试记录的起始时间
+var base = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// newRecord 返回第i条测试记录，开始时间为base之后i分钟
+func newRecord(i int, typ, status string, tags ...string) *Record {
+	started := base.Add(time.Duration(i) * time.Minute)
+	return &Record{
+		ID:         fmt.Sprintf("rec%04d", i),
+		Type:       typ,
+		Source:     "execute",
+		Command:    "curl https://example.com/",
+		Tags:       tags,
+		Status:     status,
+		StartedAt:  started,
+		FinishedAt: started.Add(time.Second),
+	}
+}
+
+// openStore 在临时目录中打开执行记录
+func openStore(t *testing.T, opts Options) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+// ids 返回一页记录的ID
+func ids(page *Page) []string {
+	out := make([]string, len(page.Records))
+	for i, rec := range page.Records {
+		out[i] = rec.ID
+	}
+	return out
+}
+
+func TestQueryFilters(t *testing.T) {
+	s, _ := openStore(t, Options{})
+	records := []*Record{
+		newRecord(0, "curl", "success", "acct1"),
+		newRecord(1, "1", "already_done", "acct1"), // 旧版本按数字别名保存的记录
+		newRecord(2, "workflow", "failed", "acct2"),
+		newRecord(3, "curl", "failed", "acct2", "acct1"),
+		newRecord(4, "js", "success"),
+	}
+	for _, rec := range records {
+		if err := s.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"全部按时间从新到旧", Query{}, []string{"rec0004", "rec0003", "rec0002", "rec0001", "rec0000"}},
+		{"类型及其别名", Query{Types: []string{"curl", "1"}}, []string{"rec0003", "rec0001", "rec0000"}},
+		{"只按名称", Query{Types: []string{"curl"}}, []string{"rec0003", "rec0000"}},
+		{"结果分类", Query{Status: "failed"}, []string{"rec0003", "rec0002"}},
+		{"标签", Query{Tag: "acct1"}, []string{"rec0003", "rec0001", "rec0000"}},
+		// from包含，to不包含
+		{"时间范围", Query{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)}, []string{"rec0002", "rec0001"}},
+		{"组合条件", Query{Types: []string{"curl", "1"}, Tag: "acct1", Status: "failed"}, []string{"rec0003"}},
+		{"没有匹配", Query{Tag: "none"}, []string{}},
+	}
+	for _, tt := range tests {
+		page, err := s.Query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := ids(page); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 得到 %v, 期望 %v", tt.name, got, tt.want)
+		}
+		if page.Total != len(tt.want) {
+			t.Errorf("%s: total = %d, 期望 %d", tt.name, page.Total, len(tt.want))
+		}
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	s, _ := openStore(t, Options{})
+	for i := 0; i < 25; i++ {
+		if err := s.Add(newRecord(i, "curl", "success")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		page, pageSize int
+		wantLen        int
+		wantFirst      string
+		wantPageSize   int
+	}{
+		{0, 0, 20, "rec0024", 20}, // 默认第1页、每页20条
+		{2, 0, 5, "rec0004", 20},
+		{3, 10, 5, "rec0004", 10},
+		{4, 10, 0, "", 10},
+		{1, 1000, 25, "rec0024", 100}, // 每页最多100条
+		{math.MaxInt, 20, 0, "", 20},  // 页码很大时不溢出
+		{math.MaxInt / 20, 20, 0, "", 20},
+	}
+	for _, tt := range tests {
+		page, err := s.Query(Query{Page: tt.page, PageSize: tt.pageSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Records) != tt.wantLen {
+			t.Errorf("page=%d page_size=%d: 得到%d条, 期望%d条", tt.page, tt.pageSize, len(page.Records), tt.wantLen)
+			continue
+		}
+		if tt.wantLen > 0 && page.Records[0].ID != tt.wantFirst {
+			t.Errorf("page=%d page_size=%d: 第一条为 %s, 期望 %s", tt.page, tt.pageSize, page.Records[0].ID, tt.wantFirst)
+		}
+		if page.PageSize != tt.wantPageSize || page.Total != 25 {
+			t.Errorf("page=%d page_size=%d: page_size=%d total=%d", tt.page, tt.pageSize, page.PageSize, page.Total)
+		}
+	}
+
+	// 空的记录文件
+	empty, _ := openStore(t, Options{})
+	page, err := empty.Query(Query{Page: math.MaxInt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 0 || page.Records == nil {
+		t.Errorf("空记录应返回空数组, 得到 %v", page.Records)
+	}
+}
+
+func TestAddTruncatesLargeResult(t *testing.T) {
+	s, _ := openStore(t, Options{MaxResultSize: 16})
+
+	small := newRecord(0, "curl", "success")
+	small.Result = json.RawMessage(`{"success":true}`)
+	large := newRecord(1, "curl", "success")
+	large.Result = json.RawMessage(`{"success":true,"data":"0123456789"}`)
+	for _, rec := range []*Record{small, large} {
+		if err := s.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range page.Records {
+		switch rec.ID {
+		case "rec0000":
+			if rec.ResultTruncated || string(rec.Result) != `{"success":true}` {
+				t.Errorf("未超过上限的结果应保存, 得到 %s truncated=%v", rec.Result, rec.ResultTruncated)
+			}
+		case "rec0001":
+			if !rec.ResultTruncated || rec.Result != nil {
+				t.Errorf("超过上限的结果不应保存, 得到 %s truncated=%v", rec.Result, rec.ResultTruncated)
+			}
+		}
+	}
+}
+
+func TestAddGeneratesID(t *testing.T) {
+	s, _ := openStore(t, Options{})
+	rec := newRecord(0, "curl", "success")
+	rec.ID = ""
+	if err := s.Add(rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.ID) != 16 {
+		t.Errorf("生成的ID = %q", rec.ID)
+	}
+}
+
+// 写入中断留下的不完整记录和无法解析的行被跳过
+func TestScanSkipsBrokenLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	var data []byte
+	for _, i := range []int{0, 1} {
+		line, err := json.Marshal(newRecord(i, "curl", "success"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+		if i == 0 {
+			data = append(data, "not json\n"...)
+			data = append(data, '\n')
+		}
+	}
+	data = append(data, `{"id":"partial","type":"cu`...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(page); !slices.Equal(got, []string{"rec0001", "rec0000"}) {
+		t.Errorf("得到 %v", got)
+	}
+}
+
+// 打开时删除超过保留时长的记录
+func TestCompactMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, age := range []time.Duration{72 * time.Hour, 49 * time.Hour, 47 * time.Hour, time.Minute} {
+		rec := newRecord(i, "curl", "success")
+		rec.StartedAt = now.Add(-age)
+		rec.FinishedAt = rec.StartedAt
+		if err := s.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err = Open(path, Options{MaxAge: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(page); !slices.Equal(got, []string{"rec0003", "rec0002"}) {
+		t.Errorf("得到 %v", got)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != s.size {
+		t.Errorf("记录的文件大小 %d 与实际大小 %d 不一致", s.size, info.Size())
+	}
+}
+
+// 超过大小上限时从最早的记录开始删除，直到文件不超过上限的3/4
+func TestCompactMaxSize(t *testing.T) {
+	line, err := json.Marshal(newRecord(0, "curl", "success"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(line) + 1)
+	maxSize := 10 * lineSize
+
+	s, path := openStore(t, Options{MaxSize: maxSize})
+	for i := 0; i < 10; i++ {
+		if err := s.Add(newRecord(i, "curl", "success")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if page, _ := s.Query(Query{}); page.Total != 10 {
+		t.Fatalf("未超过上限时不应删除记录, 剩余%d条", page.Total)
+	}
+
+	// 第11条会超过上限：删除最早的记录，使已有记录加上新记录不超过上限的3/4（7条）
+	if err := s.Add(newRecord(10, "curl", "success")); err != nil {
+		t.Fatal(err)
+	}
+	page, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"rec0010", "rec0009", "rec0008", "rec0007", "rec0006", "rec0005", "rec0004"}
+	if got := ids(page); !slices.Equal(got, want) {
+		t.Errorf("得到 %v, 期望 %v", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > maxSize*3/4 {
+		t.Errorf("文件大小 %d 超过上限的3/4（%d）", info.Size(), maxSize*3/4)
+	}
+	if info.Size() != s.size {
+		t.Errorf("记录的文件大小 %d 与实际大小 %d 不一致", s.size, info.Size())
+	}
+
+	// 重新打开时按文件的实际大小继续计算
+	s, err = Open(path, Options{MaxSize: maxSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 11; i < 14; i++ {
+		if err := s.Add(newRecord(i, "curl", "success")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if page, _ := s.Query(Query{}); page.Total != 10 {
+		t.Errorf("达到上限前不应删除记录, 剩余%d条", page.Total)
+	}
+}
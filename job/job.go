@@ -0,0 +1,304 @@
+// Package job 提供异步任务的排队与执行
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 异步任务的状态
+const (
+	StatusQueued    = "queued"    // 排队中
+	StatusRunning   = "running"   // 执行中
+	StatusSucceeded = "succeeded" // 执行成功
+	StatusFailed    = "failed"    // 执行失败
+	StatusCancelled = "cancelled" // 已取消
+)
+
+var (
+	// ErrQueueFull 等待执行的任务数已达到队列长度上限
+	ErrQueueFull = errors.New("任务队列已满")
+	// ErrNotFound 任务不存在或已过期清理
+	ErrNotFound = errors.New("任务不存在")
+	// ErrFinished 任务已经结束，不能取消
+	ErrFinished = errors.New("任务已结束")
+	// ErrStopped 任务管理器已停止
+	ErrStopped = errors.New("任务管理器已停止")
+)
+
+// RunFunc 任务的执行函数。返回错误表示任务失败，此时返回的结果仍会保存。
+// 任务被取消或管理器停止时ctx会被取消
+type RunFunc func(ctx context.Context) (interface{}, error)
+
+// Job 一个异步任务
+type Job struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	// Error 任务失败或取消的原因
+	Error string `json:"error,omitempty"`
+	// Result 任务的执行结果，与同步执行时的响应相同
+	Result      interface{} `json:"result,omitempty"`
+	SubmittedAt time.Time   `json:"submitted_at"`
+	StartedAt   *time.Time  `json:"started_at,omitempty"`
+	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
+
+	run    RunFunc
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// finished 任务是否已经结束
+func (j *Job) finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// snapshot 复制任务的当前状态，调用方需要持有管理器的锁
+func (j *Job) snapshot() *Job {
+	return &Job{
+		ID:          j.ID,
+		Type:        j.Type,
+		Status:      j.Status,
+		Error:       j.Error,
+		Result:      j.Result,
+		SubmittedAt: j.SubmittedAt,
+		StartedAt:   j.StartedAt,
+		FinishedAt:  j.FinishedAt,
+	}
+}
+
+// Options 任务管理器选项
+type Options struct {
+	// Workers 同时执行的任务数
+	Workers int
+	// QueueSize 等待执行的任务数上限
+	QueueSize int
+	// Retention 结束的任务保留多长时间供查询
+	Retention time.Duration
+}
+
+// Stats 任务管理器的当前状态
+type Stats struct {
+	Workers int `json:"workers"`
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+}
+
+// Manager 使用固定数量的worker执行异步任务，结束的任务在内存中保留一段时间供查询
+type Manager struct {
+	opts  Options
+	queue chan *Job
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	queued  int
+	running int
+	stopped bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager 创建任务管理器并启动worker
+func NewManager(opts Options) *Manager {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		opts:   opts,
+		queue:  make(chan *Job, opts.QueueSize),
+		jobs:   make(map[string]*Job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < opts.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	return m
+}
+
+// Submit 提交任务，队列已满时返回ErrQueueFull
+func (m *Manager) Submit(jobType string, run RunFunc) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return nil, ErrStopped
+	}
+	m.cleanup(time.Now())
+	if m.queued >= m.opts.QueueSize {
+		return nil, ErrQueueFull
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &Job{
+		ID:          id,
+		Type:        jobType,
+		Status:      StatusQueued,
+		SubmittedAt: time.Now(),
+		run:         run,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	// 已取消的任务仍留在通道中直到被worker取出，通道可能比排队数多占用位置
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return nil, ErrQueueFull
+	}
+	m.jobs[id] = j
+	m.queued++
+	return j.snapshot(), nil
+}
+
+// Get 查询任务的状态和结果
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cleanup(time.Now())
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel 取消任务。排队中的任务不会再执行；执行中的任务取消其上下文，
+// 任务在停止前的执行结果不再保存
+func (m *Manager) Cancel(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if j.finished() {
+		return j.snapshot(), ErrFinished
+	}
+
+	// 执行中的任务在worker返回前仍计入running
+	if j.Status == StatusQueued {
+		m.queued--
+	}
+	j.cancel()
+	m.finish(j, StatusCancelled, nil, "任务已取消")
+	return j.snapshot(), nil
+}
+
+// Stats 返回当前排队和执行中的任务数
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Stats{Workers: m.opts.Workers, Queued: m.queued, Running: m.running}
+}
+
+// Stop 取消所有未结束的任务并等待worker退出
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	m.stopped = true
+	for _, j := range m.jobs {
+		if !j.finished() {
+			m.finish(j, StatusCancelled, nil, "agent正在停止")
+		}
+	}
+	m.queued = 0
+	m.mu.Unlock()
+
+	m.cancel()
+	close(m.queue)
+	m.wg.Wait()
+}
+
+// worker 依次取出并执行任务
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for j := range m.queue {
+		if !m.start(j) {
+			continue
+		}
+		result, err := j.run(j.ctx)
+		m.complete(j, result, err)
+	}
+}
+
+// start 把任务标记为执行中，任务已取消时返回false
+func (m *Manager) start(j *Job) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j.Status != StatusQueued {
+		return false
+	}
+	now := time.Now()
+	j.Status = StatusRunning
+	j.StartedAt = &now
+	m.queued--
+	m.running++
+	return true
+}
+
+// complete 记录任务的执行结果，任务在执行中被取消时丢弃结果
+func (m *Manager) complete(j *Job, result interface{}, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j.cancel()
+	m.running--
+	if j.Status != StatusRunning {
+		return
+	}
+	if err != nil {
+		m.finish(j, StatusFailed, result, err.Error())
+		return
+	}
+	m.finish(j, StatusSucceeded, result, "")
+}
+
+// finish 设置任务的最终状态，调用方需要持有锁
+func (m *Manager) finish(j *Job, status string, result interface{}, reason string) {
+	now := time.Now()
+	j.Status = status
+	j.Result = result
+	j.Error = reason
+	j.FinishedAt = &now
+}
+
+// cleanup 删除结束时间超过保留时长的任务，调用方需要持有锁
+func (m *Manager) cleanup(now time.Time) {
+	for id, j := range m.jobs {
+		if j.FinishedAt != nil && now.Sub(*j.FinishedAt) > m.opts.Retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// newID 生成随机的任务ID
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,306 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingJob 执行后一直阻塞，直到release被关闭或ctx被取消
+type blockingJob struct {
+	started  chan struct{}
+	release  chan struct{}
+	runs     atomic.Int32 // 执行次数
+	returned atomic.Bool  // 执行函数是否已返回
+}
+
+func newBlockingJob() *blockingJob {
+	return &blockingJob{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (b *blockingJob) run(ctx context.Context) (interface{}, error) {
+	b.runs.Add(1)
+	defer b.returned.Store(true)
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return "done", nil
+	case <-ctx.Done():
+		return "partial", ctx.Err()
+	}
+}
+
+// waitStarted 等待任务开始执行
+func (b *blockingJob) waitStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case <-b.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("任务没有开始执行")
+	}
+}
+
+// waitStatus 等待任务达到指定状态
+func waitStatus(t *testing.T, m *Manager, id, status string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status == status {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("任务状态为 %s, 期望 %s", j.Status, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitStats 等待排队和执行中的任务数达到期望值
+func waitStats(t *testing.T, m *Manager, queued, running int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := m.Stats()
+		if s.Queued == queued && s.Running == running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued=%d running=%d, 期望 queued=%d running=%d", s.Queued, s.Running, queued, running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagerRun(t *testing.T) {
+	m := NewManager(Options{Workers: 2, QueueSize: 4, Retention: time.Minute})
+	defer m.Stop()
+
+	ok, err := m.Submit("curl", func(ctx context.Context) (interface{}, error) { return "ok", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok.Status != StatusQueued || ok.Type != "curl" || ok.ID == "" {
+		t.Errorf("提交后的任务: %+v", ok)
+	}
+	failed, err := m.Submit("curl", func(ctx context.Context) (interface{}, error) {
+		return "body", errors.New("断言失败")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := waitStatus(t, m, ok.ID, StatusSucceeded)
+	if j.Result != "ok" || j.Error != "" || j.StartedAt == nil || j.FinishedAt == nil {
+		t.Errorf("执行成功的任务: %+v", j)
+	}
+	// 失败的任务仍保存结果
+	j = waitStatus(t, m, failed.ID, StatusFailed)
+	if j.Result != "body" || j.Error != "断言失败" {
+		t.Errorf("执行失败的任务: %+v", j)
+	}
+	waitStats(t, m, 0, 0)
+
+	if _, err := m.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get不存在的任务返回 %v", err)
+	}
+	if _, err := m.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel不存在的任务返回 %v", err)
+	}
+	if _, err := m.Cancel(ok.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("取消已结束的任务返回 %v", err)
+	}
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	m := NewManager(Options{Workers: 1, QueueSize: 2, Retention: time.Minute})
+	defer m.Stop()
+
+	running := newBlockingJob()
+	defer close(running.release)
+	if _, err := m.Submit("curl", running.run); err != nil {
+		t.Fatal(err)
+	}
+	running.waitStarted(t)
+
+	// 执行中的任务不占用队列
+	var queued []string
+	for i := 0; i < 2; i++ {
+		j, err := m.Submit("curl", newBlockingJob().run)
+		if err != nil {
+			t.Fatalf("第%d个排队的任务: %v", i+1, err)
+		}
+		queued = append(queued, j.ID)
+	}
+	waitStats(t, m, 2, 1)
+
+	if _, err := m.Submit("curl", newBlockingJob().run); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("队列已满时返回 %v", err)
+	}
+	waitStats(t, m, 2, 1)
+
+	for _, id := range queued {
+		if _, err := m.Cancel(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitStats(t, m, 0, 1)
+}
+
+func TestManagerCancelQueued(t *testing.T) {
+	m := NewManager(Options{Workers: 1, QueueSize: 2, Retention: time.Minute})
+	defer m.Stop()
+
+	running := newBlockingJob()
+	if _, err := m.Submit("curl", running.run); err != nil {
+		t.Fatal(err)
+	}
+	running.waitStarted(t)
+
+	pending := newBlockingJob()
+	j, err := m.Submit("curl", pending.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := m.Cancel(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != StatusCancelled || cancelled.FinishedAt == nil || cancelled.StartedAt != nil {
+		t.Errorf("取消的任务: %+v", cancelled)
+	}
+	waitStats(t, m, 0, 1)
+
+	// worker取出已取消的任务后跳过，不会执行
+	close(running.release)
+	next, err := m.Submit("curl", func(ctx context.Context) (interface{}, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, m, next.ID, StatusSucceeded)
+	if n := pending.runs.Load(); n != 0 {
+		t.Errorf("已取消的任务执行了%d次", n)
+	}
+	if j, _ := m.Get(j.ID); j.Status != StatusCancelled {
+		t.Errorf("已取消的任务状态变为 %s", j.Status)
+	}
+	waitStats(t, m, 0, 0)
+}
+
+func TestManagerCancelRunning(t *testing.T) {
+	m := NewManager(Options{Workers: 1, QueueSize: 1, Retention: time.Minute})
+	defer m.Stop()
+
+	running := newBlockingJob()
+	j, err := m.Submit("curl", running.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running.waitStarted(t)
+
+	cancelled, err := m.Cancel(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != StatusCancelled || cancelled.Error != "任务已取消" {
+		t.Errorf("取消的任务: %+v", cancelled)
+	}
+
+	// 执行函数返回后才不再计入running，返回的结果被丢弃
+	waitStats(t, m, 0, 0)
+	if !running.returned.Load() {
+		t.Error("执行函数返回前running已减少")
+	}
+	j, err = m.Get(j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Status != StatusCancelled || j.Result != nil {
+		t.Errorf("取消后保存了结果: %+v", j)
+	}
+}
+
+func TestManagerStop(t *testing.T) {
+	m := NewManager(Options{Workers: 1, QueueSize: 2, Retention: time.Minute})
+
+	running := newBlockingJob()
+	first, err := m.Submit("curl", running.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running.waitStarted(t)
+	pending := newBlockingJob()
+	second, err := m.Submit("curl", pending.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stop取消执行中的任务，并等待执行函数返回后才返回
+	m.Stop()
+	if !running.returned.Load() {
+		t.Error("Stop在执行中的任务返回前返回")
+	}
+	if n := pending.runs.Load(); n != 0 {
+		t.Errorf("Stop之后排队的任务执行了%d次", n)
+	}
+	for _, id := range []string{first.ID, second.ID} {
+		j, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status != StatusCancelled || j.Error != "agent正在停止" || j.Result != nil {
+			t.Errorf("停止后的任务: %+v", j)
+		}
+	}
+	if s := m.Stats(); s.Queued != 0 || s.Running != 0 {
+		t.Errorf("停止后 queued=%d running=%d", s.Queued, s.Running)
+	}
+
+	if _, err := m.Submit("curl", newBlockingJob().run); !errors.Is(err, ErrStopped) {
+		t.Errorf("停止后提交返回 %v", err)
+	}
+	// 重复调用Stop直接返回
+	m.Stop()
+}
+
+func TestManagerRetention(t *testing.T) {
+	m := NewManager(Options{Workers: 1, QueueSize: 1, Retention: time.Minute})
+	defer m.Stop()
+
+	done, err := m.Submit("curl", func(ctx context.Context) (interface{}, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := waitStatus(t, m, done.ID, StatusSucceeded)
+
+	running := newBlockingJob()
+	defer close(running.release)
+	active, err := m.Submit("curl", running.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running.waitStarted(t)
+
+	m.mu.Lock()
+	m.cleanup(finished.FinishedAt.Add(time.Minute))
+	m.mu.Unlock()
+	if _, err := m.Get(done.ID); err != nil {
+		t.Errorf("未超过保留时长的任务被删除: %v", err)
+	}
+
+	m.mu.Lock()
+	m.cleanup(finished.FinishedAt.Add(time.Minute + time.Second))
+	m.mu.Unlock()
+	if _, err := m.Get(done.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("超过保留时长的任务返回 %v", err)
+	}
+	// 未结束的任务不会被删除
+	if _, err := m.Get(active.ID); err != nil {
+		t.Errorf("执行中的任务被删除: %v", err)
+	}
+}
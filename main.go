@@ -46,6 +46,24 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "secret" {
+		// 处理secret子命令
+		secretCmd := flag.NewFlagSet("secret", flag.ExitOnError)
+		secretCmd.StringVar(&configPath, "config", "", "配置文件路径 (默认: ./agent_config.json)")
+		secretCmd.Usage = func() {
+			fmt.Fprintln(os.Stderr, cmd.SecretUsage)
+		}
+
+		if err := secretCmd.Parse(os.Args[2:]); err != nil {
+			log.Fatalf("解析参数失败: %v", err)
+		}
+
+		if err := cmd.Secret(configPath, secretCmd.Args()); err != nil {
+			log.Fatalf("管理密钥失败: %v", err)
+		}
+		return
+	}
+
 	if err := mainCmd.Parse(os.Args[1:]); err != nil {
 		log.Fatalf("解析参数失败: %v", err)
 	}
@@ -0,0 +1,227 @@
+// Package schedule 提供agent本地的定时任务
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查找下一次执行时间时最多向后查找的年数，超过时认为表达式不会再匹配（如2月30日）
+const maxSearchYears = 5
+
+// cronField 表达式中一个字段的取值范围和名称
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "分钟", min: 0, max: 59}
+	hourField   = cronField{name: "小时", min: 0, max: 23}
+	domField    = cronField{name: "日期", min: 1, max: 31}
+	monthField  = cronField{name: "月份", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 星期中0和7都表示星期日
+	dowField = cronField{name: "星期", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// 预定义的表达式
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron 解析后的cron表达式，每个字段用位集合表示允许的值
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// 日期和星期都有限制时，与标准cron一样满足其一即可
+	domRestricted, dowRestricted bool
+	// 小时有限制时，夏令时结束重复的一小时内只执行一次
+	hourRestricted bool
+}
+
+// ParseCron 解析标准的5字段cron表达式（分 时 日 月 周），支持 * , - / 、
+// 月份和星期的英文缩写，以及 @daily、@hourly 等预定义表达式
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron表达式必须包含5个字段（分 时 日 月 周）: %q", expr)
+	}
+
+	c := &Cron{}
+	var err error
+	if c.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if c.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if c.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if c.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if c.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.hourRestricted = !strings.HasPrefix(fields[1], "*")
+	c.domRestricted = !strings.HasPrefix(fields[2], "*")
+	c.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parse 解析一个字段，返回允许的值的位集合
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron表达式的%s字段步长无效: %q", f.name, part)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = f.min, f.max
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("cron表达式的%s字段范围无效: %q", f.name, part)
+			}
+		default:
+			v, err := f.value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			// 与常见的cron实现一样，a/n 表示从a开始到最大值每隔n
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value 解析字段中的一个数值或英文缩写
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("cron表达式的%s字段取值无效: %q（范围%d-%d）", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// dayMatches 检查日期是否满足日期和星期字段
+func (c *Cron) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// hourMatches 检查小时字段。夏令时开始时跳过的小时内的执行时间，改在跳过后的第一个小时内执行
+func (c *Cron) hourMatches(t time.Time) bool {
+	if c.hour&(1<<uint(t.Hour())) != 0 {
+		return true
+	}
+	before := t.Add(-time.Hour)
+	_, offsetBefore := before.Zone()
+	_, offset := t.Zone()
+	if offset <= offsetBefore || before.Day() != t.Day() {
+		return false
+	}
+	for h := before.Hour() + 1; h < t.Hour(); h++ {
+		if c.hour&(1<<uint(h)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatedHour t是否在夏令时结束后重复的一小时内
+func repeatedHour(t time.Time) bool {
+	before := t.Add(-time.Hour)
+	_, offsetBefore := before.Zone()
+	_, offset := t.Zone()
+	return offset < offsetBefore && before.Hour() == t.Hour()
+}
+
+// Next 返回t之后（不含t）的下一次执行时间，按t所在的时区计算。
+// 表达式不会再匹配时返回零值
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(end) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.hourMatches(t) {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			// 夏令时切换时按本地时间计算可能不前进，改为按绝对时间前进
+			if !next.After(t) {
+				next = t.Add(time.Hour).Truncate(time.Hour)
+			}
+			t = next
+			continue
+		}
+		if c.hourRestricted && repeatedHour(t) {
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
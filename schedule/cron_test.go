@@ -0,0 +1,229 @@
+package schedule
+
+import (
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata" // 夏令时的用例不依赖系统的时区数据
+)
+
+// bits 返回包含vals的位集合
+func bits(vals ...int) uint64 {
+	var b uint64
+	for _, v := range vals {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+// span 返回lo到hi（含）每隔step的位集合
+func span(lo, hi, step int) uint64 {
+	var b uint64
+	for v := lo; v <= hi; v += step {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr                          string
+		minute, hour, dom, month, dow uint64
+	}{
+		{"* * * * *", span(0, 59, 1), span(0, 23, 1), span(1, 31, 1), span(1, 12, 1), span(0, 7, 1)},
+		{"0 8 1 1 0", bits(0), bits(8), bits(1), bits(1), bits(0)},
+		{"1,2,3 1-5 10-12 * *", bits(1, 2, 3), span(1, 5, 1), span(10, 12, 1), span(1, 12, 1), span(0, 7, 1)},
+		{"*/15 */6 * * *", bits(0, 15, 30, 45), bits(0, 6, 12, 18), span(1, 31, 1), span(1, 12, 1), span(0, 7, 1)},
+		// a/n 表示从a开始到最大值每隔n
+		{"5/20 10-20/5 1/10 * *", bits(5, 25, 45), bits(10, 15, 20), bits(1, 11, 21, 31), span(1, 12, 1), span(0, 7, 1)},
+		{"0 0 * jan-mar,DEC mon-fri", bits(0), bits(0), span(1, 31, 1), bits(1, 2, 3, 12), span(1, 5, 1)},
+		// 7和0都表示星期日
+		{"0 0 * * 7", bits(0), bits(0), span(1, 31, 1), span(1, 12, 1), bits(0, 7)},
+		{"0 0 * * sat-7", bits(0), bits(0), span(1, 31, 1), span(1, 12, 1), bits(0, 6, 7)},
+		{"@hourly", bits(0), span(0, 23, 1), span(1, 31, 1), span(1, 12, 1), span(0, 7, 1)},
+		{"  @Daily ", bits(0), bits(0), span(1, 31, 1), span(1, 12, 1), span(0, 7, 1)},
+		{"@weekly", bits(0), bits(0), span(1, 31, 1), span(1, 12, 1), bits(0)},
+		{"@yearly", bits(0), bits(0), bits(1), bits(1), span(0, 7, 1)},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) 返回错误: %v", tt.expr, err)
+			continue
+		}
+		got := [5]uint64{c.minute, c.hour, c.dom, c.month, c.dow}
+		want := [5]uint64{tt.minute, tt.hour, tt.dom, tt.month, tt.dow}
+		if got != want {
+			t.Errorf("ParseCron(%q) = %b, 期望 %b", tt.expr, got, want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1-2-3 * * * *",
+		"* * * foo *",
+		"* * * * sunday",
+		"@every",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, shanghai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"30 8 * * *", "2024-05-01 08:00", "2024-05-01 08:30"},
+		// 不含from本身
+		{"30 8 * * *", "2024-05-01 08:30", "2024-05-02 08:30"},
+		{"*/15 * * * *", "2024-05-01 23:50", "2024-05-02 00:00"},
+		{"0 0 1 * *", "2024-12-15 12:00", "2025-01-01 00:00"},
+		// 2024-05-01是星期三
+		{"0 9 * * mon-fri", "2024-05-03 10:00", "2024-05-06 09:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) 返回错误: %v", tt.expr, err)
+		}
+		if got, want := c.Next(at(tt.from)), at(tt.want); !got.Equal(want) {
+			t.Errorf("%q.Next(%s) = %s, 期望 %s", tt.expr, tt.from, got, want)
+		}
+	}
+}
+
+func TestCronNextNeverMatches(t *testing.T) {
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("2月30日不应匹配，得到 %s", got)
+	}
+}
+
+// 日期和星期都有限制时满足其一即可，只限制其中一个时只按该字段匹配
+func TestCronDayOfMonthOrWeekday(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []int // 2024年10月中匹配的日期，10月1日是星期二
+	}{
+		{"0 9 13 * fri", []int{4, 11, 13, 18, 25}},
+		{"0 9 13 * *", []int{13}},
+		{"0 9 * * fri", []int{4, 11, 18, 25}},
+		{"0 9 1,31 * sun", []int{1, 6, 13, 20, 27, 31}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) 返回错误: %v", tt.expr, err)
+		}
+		var got []int
+		for next := c.Next(time.Date(2024, 9, 30, 9, 0, 0, 0, time.UTC)); next.Month() == time.October; next = c.Next(next) {
+			got = append(got, next.Day())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q 在2024年10月匹配 %v, 期望 %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+// 纽约2024-03-10 02:00跳到03:00，2024-11-03 02:00回到01:00
+func TestCronNextDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name, expr string
+		from       time.Time // UTC
+		want       []string  // 之后依次的执行时间（UTC）
+	}{
+		{
+			// 跳过的02:30改在03:30执行，次日恢复02:30
+			name: "夏令时开始跳过的时间",
+			expr: "30 2 * * *",
+			from: utc("2024-03-10 05:00"), // 00:00 EST
+			want: []string{"2024-03-10 07:30", "2024-03-11 06:30"},
+		},
+		{
+			// 00:30 EST之后依次为01:00 EST、03:00 EDT、04:00 EDT
+			name: "夏令时开始前后的整点",
+			expr: "0 * * * *",
+			from: utc("2024-03-10 05:30"),
+			want: []string{"2024-03-10 06:00", "2024-03-10 07:00", "2024-03-10 08:00"},
+		},
+		{
+			// 重复的01:30只执行一次
+			name: "夏令时结束重复的小时",
+			expr: "30 1 * * *",
+			from: utc("2024-11-03 04:00"), // 00:00 EDT
+			want: []string{"2024-11-03 05:30", "2024-11-04 06:30"},
+		},
+		{
+			// 小时不限制时重复的一小时内同样执行
+			name: "夏令时结束每半小时",
+			expr: "*/30 * * * *",
+			from: utc("2024-11-03 05:00"), // 01:00 EDT
+			want: []string{"2024-11-03 05:30", "2024-11-03 06:00", "2024-11-03 06:30", "2024-11-03 07:00"},
+		},
+		{
+			// 2024-11-02 04:00 EDT之后，03:00按EST计算
+			name: "夏令时结束当天的每日任务",
+			expr: "0 3 * * *",
+			from: utc("2024-11-02 08:00"),
+			want: []string{"2024-11-03 08:00", "2024-11-04 08:00"},
+		},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) 返回错误: %v", tt.expr, err)
+		}
+		next := tt.from.In(newYork)
+		for _, w := range tt.want {
+			next = c.Next(next)
+			if want := utc(w); !next.Equal(want) {
+				t.Errorf("%s: %q 得到 %s, 期望 %s", tt.name, tt.expr, next.UTC().Format("2006-01-02 15:04"), w)
+				break
+			}
+		}
+	}
+}
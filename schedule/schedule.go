@@ -0,0 +1,519 @@
+// Package schedule 提供agent本地的定时任务
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 错过执行时间（agent未运行、系统休眠等）时的处理方式
+const (
+	MissedSkip    = "skip"     // 跳过错过的执行（默认）
+	MissedRunOnce = "run_once" // 无论错过几次，只补执行一次
+	MissedCatchUp = "catch_up" // 错过的每一次都补执行
+)
+
+// 定时任务的来源
+const (
+	SourceConfig = "config" // 配置文件中定义，只能通过修改配置文件更改
+	SourceAPI    = "api"    // 通过API注册，保存在定时任务文件中
+)
+
+const (
+	// 计划时间之后这段时间内触发都算按时执行，超过后按错过执行处理
+	lateGrace = time.Minute
+	// catch_up 最多补执行的次数
+	maxCatchUp = 100
+	// 调度循环的最长休眠时间，用于及时发现系统时间的调整和休眠唤醒
+	maxSleep = time.Minute
+	// 定时任务名称的最大长度
+	maxNameLength = 64
+)
+
+// 定时任务名称只能包含字母、数字和 _ . -
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+var (
+	// ErrNotFound 定时任务不存在
+	ErrNotFound = errors.New("定时任务不存在")
+	// ErrReadOnly 配置文件中定义的定时任务不能通过API修改或删除
+	ErrReadOnly = errors.New("配置文件中定义的定时任务不能通过API修改")
+)
+
+// Schedule 一个定时任务的定义
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron 5字段的cron表达式，如 "30 8 * * *" 表示每天8:30
+	Cron string `json:"cron"`
+	// Timezone 计算执行时间使用的时区，如 Asia/Shanghai，为空时使用系统时区
+	Timezone string `json:"timezone,omitempty"`
+	// Missed 错过执行时间时的处理方式：skip（默认）、run_once或catch_up
+	Missed string `json:"missed,omitempty"`
+	// Task 要执行的任务，格式与 /api/task/execute 的请求体相同，由调用方解析
+	Task json.RawMessage `json:"task"`
+}
+
+// Validate 检查名称、cron表达式、时区和错过执行的处理方式
+func (s *Schedule) Validate() error {
+	_, _, err := s.parse()
+	return err
+}
+
+// parse 解析cron表达式和时区
+func (s *Schedule) parse() (*Cron, *time.Location, error) {
+	if s.Name == "" || len(s.Name) > maxNameLength || !validName.MatchString(s.Name) {
+		return nil, nil, fmt.Errorf("定时任务名称无效: %q（只能包含字母、数字和 _ . -，最长%d个字符）", s.Name, maxNameLength)
+	}
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.Local
+	if s.Timezone != "" {
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, nil, fmt.Errorf("时区无效: %s", s.Timezone)
+		}
+	}
+	switch s.Missed {
+	case "", MissedSkip, MissedRunOnce, MissedCatchUp:
+	default:
+		return nil, nil, fmt.Errorf("不支持的错过执行处理方式: %s", s.Missed)
+	}
+	if len(s.Task) == 0 {
+		return nil, nil, fmt.Errorf("定时任务 %s 缺少任务", s.Name)
+	}
+	return cron, loc, nil
+}
+
+// Status 定时任务的定义和执行状态
+type Status struct {
+	Schedule
+	Source    string     `json:"source"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastJobID string     `json:"last_job_id,omitempty"`
+	// LastError 上一次触发失败的原因（如任务队列已满），任务本身的结果见执行记录
+	LastError string `json:"last_error,omitempty"`
+}
+
+// RunFunc 触发一次定时任务，返回异步任务的ID
+type RunFunc func(s *Schedule) (string, error)
+
+// state 定时任务的执行状态，保存在定时任务文件中，重启后用于发现错过的执行
+type state struct {
+	// Cron 计算Checked时使用的表达式，表达式改变后不再补执行旧表达式错过的时间
+	Cron string `json:"cron"`
+	// Checked 此前的执行时间都已触发或按处理方式跳过
+	Checked   time.Time  `json:"checked"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastJobID string     `json:"last_job_id,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// entry 调度中的一个定时任务
+type entry struct {
+	schedule Schedule
+	source   string
+	cron     *Cron
+	loc      *time.Location
+	state    state
+}
+
+// due 返回到now为止需要触发的次数，按时的执行总是触发，错过的执行按处理方式决定
+func (e *entry) due(now time.Time) int {
+	boundary := now.Add(-lateGrace)
+	from := e.state.Checked
+	if from.Before(boundary) {
+		from = boundary
+	}
+	onTime := 0
+	if next := e.cron.Next(from.In(e.loc)); !next.IsZero() && !next.After(now) {
+		onTime = 1
+	}
+
+	missed := 0
+	if e.state.Checked.Before(boundary) {
+		for t := e.cron.Next(e.state.Checked.In(e.loc)); !t.IsZero() && !t.After(boundary) && missed < maxCatchUp; t = e.cron.Next(t) {
+			missed++
+		}
+	}
+	if missed == 0 {
+		return onTime
+	}
+
+	switch e.schedule.Missed {
+	case MissedRunOnce:
+		log.Printf("定时任务 %s 错过了执行时间，补执行一次", e.schedule.Name)
+		return 1
+	case MissedCatchUp:
+		log.Printf("定时任务 %s 错过了%d次执行，逐次补执行", e.schedule.Name, missed)
+		return missed + onTime
+	default:
+		log.Printf("定时任务 %s 错过了%d次执行，已跳过", e.schedule.Name, missed)
+		return onTime
+	}
+}
+
+// status 返回定时任务的状态，时间按定时任务的时区显示
+func (e *entry) status(now time.Time) Status {
+	st := Status{
+		Schedule:  e.schedule,
+		Source:    e.source,
+		LastJobID: e.state.LastJobID,
+		LastError: e.state.LastError,
+	}
+	if next := e.cron.Next(now.In(e.loc)); !next.IsZero() {
+		st.NextRun = &next
+	}
+	if e.state.LastRun != nil {
+		last := e.state.LastRun.In(e.loc)
+		st.LastRun = &last
+	}
+	return st
+}
+
+// stateFile 定时任务文件的格式
+type stateFile struct {
+	// Schedules 通过API注册的定时任务
+	Schedules []Schedule `json:"schedules"`
+	// State 所有定时任务（包括配置文件中定义的）的执行状态
+	State map[string]*state `json:"state"`
+}
+
+// Scheduler 按cron表达式触发定时任务。API注册的定时任务和所有任务的执行状态保存在文件中，
+// agent重启或系统休眠后按各任务的处理方式补执行错过的时间
+type Scheduler struct {
+	path string
+	run  RunFunc
+
+	mu      sync.Mutex
+	entries map[string]*entry
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	started bool
+}
+
+// New 创建调度器，加载配置文件中定义的定时任务static和文件中保存的定时任务。
+// 调用Start后开始调度，run在调度协程中调用，应尽快返回
+func New(path string, static []Schedule, run RunFunc) (*Scheduler, error) {
+	s := &Scheduler{
+		path:    path,
+		run:     run,
+		entries: make(map[string]*entry),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	file, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, sch := range static {
+		if _, ok := s.entries[sch.Name]; ok {
+			return nil, fmt.Errorf("定时任务 %s 重复定义", sch.Name)
+		}
+		if err := s.add(sch, SourceConfig, file.State[sch.Name], now); err != nil {
+			return nil, err
+		}
+	}
+	for _, sch := range file.Schedules {
+		if _, ok := s.entries[sch.Name]; ok {
+			log.Printf("定时任务 %s 已在配置文件中定义，忽略通过API注册的同名任务", sch.Name)
+			continue
+		}
+		if err := s.add(sch, SourceAPI, file.State[sch.Name], now); err != nil {
+			return nil, err
+		}
+	}
+
+	// 保存新增任务的状态，此后重启时才能发现它们错过的执行
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// add 添加定时任务。没有保存的状态或表达式已改变时从now开始调度，调用方需要持有锁
+func (s *Scheduler) add(sch Schedule, source string, saved *state, now time.Time) error {
+	cron, loc, err := sch.parse()
+	if err != nil {
+		return err
+	}
+	e := &entry{schedule: sch, source: source, cron: cron, loc: loc}
+	if saved != nil {
+		e.state = *saved
+	}
+	if saved == nil || saved.Cron != sch.Cron || saved.Checked.After(now) {
+		e.state.Cron = sch.Cron
+		e.state.Checked = now
+	}
+	s.entries[sch.Name] = e
+	return nil
+}
+
+// Start 在后台开始调度，首次检查时处理agent未运行期间错过的执行
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	go s.loop()
+}
+
+// Stop 停止调度并等待调度协程退出
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	select {
+	case <-s.stop:
+		return
+	default:
+		close(s.stop)
+	}
+	if started {
+		<-s.done
+	}
+}
+
+// List 返回所有定时任务的定义和状态，按名称排序
+func (s *Scheduler) List() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	list := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e.status(now))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Put 注册或更新通过API定义的定时任务，更新后从当前时间开始调度
+func (s *Scheduler) Put(sch Schedule) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.entries[sch.Name]
+	if exists && old.source == SourceConfig {
+		return Status{}, ErrReadOnly
+	}
+	var saved *state
+	if exists {
+		// 保留上一次执行的信息，但不补执行修改前错过的时间
+		st := old.state
+		st.Cron = ""
+		saved = &st
+	}
+	now := time.Now()
+	if err := s.add(sch, SourceAPI, saved, now); err != nil {
+		if exists {
+			s.entries[sch.Name] = old
+		}
+		return Status{}, err
+	}
+	if err := s.save(); err != nil {
+		if exists {
+			s.entries[sch.Name] = old
+		} else {
+			delete(s.entries, sch.Name)
+		}
+		return Status{}, err
+	}
+	s.notify()
+	return s.entries[sch.Name].status(now), nil
+}
+
+// Delete 删除通过API定义的定时任务
+func (s *Scheduler) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.source == SourceConfig {
+		return ErrReadOnly
+	}
+	delete(s.entries, name)
+	if err := s.save(); err != nil {
+		s.entries[name] = e
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// notify 唤醒调度协程重新计算休眠时间
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop 调度协程：检查并触发到期的任务，然后休眠到下一次执行时间
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	for {
+		s.tick(time.Now())
+
+		timer := time.NewTimer(s.sleep(time.Now()))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// sleep 返回距离最近一次执行的时间，不超过maxSleep
+func (s *Scheduler) sleep(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := maxSleep
+	for _, e := range s.entries {
+		if next := e.cron.Next(now.In(e.loc)); !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+	}
+	return wait
+}
+
+// tick 触发到now为止到期的任务
+func (s *Scheduler) tick(now time.Time) {
+	type dueRun struct {
+		schedule Schedule
+		times    int
+	}
+
+	s.mu.Lock()
+	var runs []dueRun
+	changed := false
+	for _, e := range s.entries {
+		// 上次检查后没有经过执行时间时不需要保存状态
+		if next := e.cron.Next(e.state.Checked.In(e.loc)); next.IsZero() || next.After(now) {
+			e.state.Checked = now
+			continue
+		}
+		changed = true
+		if times := e.due(now); times > 0 {
+			runs = append(runs, dueRun{schedule: e.schedule, times: times})
+		}
+		e.state.Checked = now
+	}
+	s.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].schedule.Name < runs[j].schedule.Name })
+
+	for _, r := range runs {
+		var jobID string
+		var err error
+		for i := 0; i < r.times; i++ {
+			if jobID, err = s.run(&r.schedule); err != nil {
+				log.Printf("触发定时任务 %s 失败: %v", r.schedule.Name, err)
+			}
+		}
+
+		s.mu.Lock()
+		// 任务在执行期间被删除或修改时不再更新状态
+		if e, ok := s.entries[r.schedule.Name]; ok && e.state.Cron == r.schedule.Cron {
+			e.state.LastRun = &now
+			e.state.LastJobID = jobID
+			e.state.LastError = ""
+			if err != nil {
+				e.state.LastError = err.Error()
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(); err != nil {
+		log.Printf("保存定时任务状态失败: %v", err)
+	}
+}
+
+// load 读取定时任务文件，文件不存在时返回空内容
+func (s *Scheduler) load() (*stateFile, error) {
+	file := &stateFile{State: make(map[string]*state)}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取定时任务文件失败: %v", err)
+	}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("解析定时任务文件失败: %v", err)
+	}
+	if file.State == nil {
+		file.State = make(map[string]*state)
+	}
+	return file, nil
+}
+
+// save 保存API注册的定时任务和所有任务的状态，调用方需要持有锁。
+// 任务中可能包含凭据，文件只有所有者可以读写
+func (s *Scheduler) save() error {
+	file := stateFile{Schedules: []Schedule{}, State: make(map[string]*state, len(s.entries))}
+	for name, e := range s.entries {
+		if e.source == SourceAPI {
+			file.Schedules = append(file.Schedules, e.schedule)
+		}
+		st := e.state
+		file.State[name] = &st
+	}
+	sort.Slice(file.Schedules, func(i, j int) bool { return file.Schedules[i].Name < file.Schedules[j].Name })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化定时任务失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("写入定时任务文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入定时任务文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入定时任务文件失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("写入定时任务文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 结果分类
+const (
+	OutcomeSuccess     = "success"      // 成功
+	OutcomeAlreadyDone = "already_done" // 已完成，如“今日已签到”
+	OutcomeFailed      = "failed"       // 失败
+)
+
+// Assertion 对请求结果的一项检查，Status、JSON、Regex、NotRegex、Header五选一
+type Assertion struct {
+	// Status 状态码必须是其中之一
+	Status []int `json:"status,omitempty"`
+	// JSON 响应体中的JSONPath，单独使用时检查该路径存在，也可以配合Equals或Contains
+	JSON string `json:"json,omitempty"`
+	// Regex 响应体必须匹配的正则表达式
+	Regex string `json:"regex,omitempty"`
+	// NotRegex 响应体不能匹配的正则表达式
+	NotRegex string `json:"not_regex,omitempty"`
+	// Header 必须存在的响应头，也可以配合Equals或Contains检查它的值
+	Header string `json:"header,omitempty"`
+
+	// Equals JSON或Header的值必须等于它。数字按数值比较，字符串与数字按文本比较，如 "0" 等于 0
+	Equals json.RawMessage `json:"equals,omitempty"`
+	// Contains JSON或Header的值（对象和数组按JSON文本）必须包含该字符串
+	Contains string `json:"contains,omitempty"`
+}
+
+// validate 检查断言的定义是否有效
+func (a *Assertion) validate() error {
+	kinds := 0
+	if len(a.Status) > 0 {
+		kinds++
+	}
+	for _, kind := range []string{a.JSON, a.Regex, a.NotRegex, a.Header} {
+		if kind != "" {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("断言必须且只能指定status、json、regex、not_regex、header之一")
+	}
+
+	if (len(a.Equals) > 0 || a.Contains != "") && a.JSON == "" && a.Header == "" {
+		return fmt.Errorf("equals和contains只能与json或header一起使用")
+	}
+	if len(a.Equals) > 0 && a.Contains != "" {
+		return fmt.Errorf("断言不能同时指定equals和contains")
+	}
+	if len(a.Equals) > 0 {
+		if _, err := a.expected(); err != nil {
+			return err
+		}
+	}
+	if a.JSON != "" {
+		if _, err := parseJSONPath(a.JSON); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range []string{a.Regex, a.NotRegex} {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("断言的正则表达式无效: %v", err)
+		}
+	}
+	return nil
+}
+
+// expected 解析Equals的期望值
+func (a *Assertion) expected() (interface{}, error) {
+	value, err := parseJSONBody(string(a.Equals))
+	if err != nil {
+		return nil, fmt.Errorf("断言的equals不是有效的JSON值: %s", a.Equals)
+	}
+	return value, nil
+}
+
+// check 检查请求结果，不满足时返回原因
+func (a *Assertion) check(result *CurlResult) error {
+	switch {
+	case len(a.Status) > 0:
+		for _, code := range a.Status {
+			if result.StatusCode == code {
+				return nil
+			}
+		}
+		return fmt.Errorf("状态码 %d 不在 %v 中", result.StatusCode, a.Status)
+
+	case a.JSON != "":
+		doc, err := parseJSONBody(result.Body)
+		if err != nil {
+			return err
+		}
+		value, found, err := evalJSONPath(doc, a.JSON)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("响应中不存在 %s", a.JSON)
+		}
+		return a.compare(a.JSON+" 的值", []interface{}{value})
+
+	case a.Regex != "":
+		if !regexp.MustCompile(a.Regex).MatchString(result.Body) {
+			return fmt.Errorf("响应体不匹配 %s", a.Regex)
+		}
+		return nil
+
+	case a.NotRegex != "":
+		if regexp.MustCompile(a.NotRegex).MatchString(result.Body) {
+			return fmt.Errorf("响应体匹配了 %s", a.NotRegex)
+		}
+		return nil
+
+	default:
+		values := http.Header(result.Headers).Values(a.Header)
+		if len(values) == 0 {
+			return fmt.Errorf("缺少响应头 %s", a.Header)
+		}
+		actual := make([]interface{}, len(values))
+		for i, v := range values {
+			actual[i] = v
+		}
+		return a.compare("响应头 "+a.Header, actual)
+	}
+}
+
+// compare 按Equals或Contains检查值，多个值（如同名响应头）中有一个满足即可
+func (a *Assertion) compare(subject string, values []interface{}) error {
+	switch {
+	case len(a.Equals) > 0:
+		expected, err := a.expected()
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if jsonValueEqual(v, expected) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s为 %s，期望 %s", subject, formatValues(values), jsonValueString(expected))
+
+	case a.Contains != "":
+		for _, v := range values {
+			if strings.Contains(jsonValueString(v), a.Contains) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s %s 不包含 %q", subject, formatValues(values), a.Contains)
+	}
+	return nil
+}
+
+// String 描述断言的条件
+func (a *Assertion) String() string {
+	var subject string
+	switch {
+	case len(a.Status) > 0:
+		return fmt.Sprintf("状态码属于 %v", a.Status)
+	case a.Regex != "":
+		return fmt.Sprintf("响应体匹配 %s", a.Regex)
+	case a.NotRegex != "":
+		return fmt.Sprintf("响应体不匹配 %s", a.NotRegex)
+	case a.JSON != "":
+		subject = a.JSON
+	default:
+		subject = "响应头 " + a.Header
+	}
+
+	switch {
+	case len(a.Equals) > 0:
+		return fmt.Sprintf("%s 等于 %s", subject, a.Equals)
+	case a.Contains != "":
+		return fmt.Sprintf("%s 包含 %q", subject, a.Contains)
+	}
+	return subject + " 存在"
+}
+
+// jsonValueEqual 比较两个JSON值：数字按数值比较，其他值按文本比较
+func jsonValueEqual(actual, expected interface{}) bool {
+	a, aIsNum := actual.(json.Number)
+	e, eIsNum := expected.(json.Number)
+	if aIsNum && eIsNum {
+		af, err1 := strconv.ParseFloat(a.String(), 64)
+		ef, err2 := strconv.ParseFloat(e.String(), 64)
+		if err1 == nil && err2 == nil {
+			return af == ef
+		}
+	}
+	if (actual == nil) != (expected == nil) {
+		return false
+	}
+	return jsonValueString(actual) == jsonValueString(expected)
+}
+
+// formatValues 输出实际的值，用于错误信息
+func formatValues(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = jsonValueString(v)
+		if runes := []rune(parts[i]); len(runes) > 200 {
+			parts[i] = string(runes[:200]) + "..."
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Outcome 根据断言对任务结果的分类
+type Outcome struct {
+	// Status 分类：success、already_done或failed
+	Status string `json:"status"`
+	// Assertion 决定分类的断言，未配置断言或请求失败时为空
+	Assertion *Assertion `json:"assertion,omitempty"`
+	// Reason 分类的原因
+	Reason string `json:"reason,omitempty"`
+	// Step 工作流中决定分类的步骤
+	Step string `json:"step,omitempty"`
+}
+
+// Expectation 判定请求结果的断言
+type Expectation struct {
+	// Assert 成功时必须全部满足的断言，为空时状态码小于400即为成功
+	Assert []Assertion `json:"assert,omitempty" desc:"成功时必须全部满足的断言，为空时状态码小于400即为成功"`
+	// AlreadyDone 任一满足时结果为已完成（如响应中包含“已签到”），优先于Assert判断
+	AlreadyDone []Assertion `json:"already_done,omitempty" desc:"任一满足时结果为already_done（如已签到），优先于assert判断"`
+}
+
+// Validate 检查所有断言的定义
+func (e *Expectation) Validate() error {
+	for i := range e.AlreadyDone {
+		if err := e.AlreadyDone[i].validate(); err != nil {
+			return fmt.Errorf("already_done: %v", err)
+		}
+	}
+	for i := range e.Assert {
+		if err := e.Assert[i].validate(); err != nil {
+			return fmt.Errorf("assert: %v", err)
+		}
+	}
+	return nil
+}
+
+// Classify 对请求结果分类：先检查AlreadyDone，再依次检查Assert，第一个不满足的断言决定失败
+func (e *Expectation) Classify(result *CurlResult) *Outcome {
+	for i := range e.AlreadyDone {
+		a := &e.AlreadyDone[i]
+		if a.check(result) == nil {
+			return &Outcome{Status: OutcomeAlreadyDone, Assertion: a, Reason: a.String()}
+		}
+	}
+
+	if len(e.Assert) == 0 {
+		if result.StatusCode >= 400 {
+			return &Outcome{Status: OutcomeFailed, Reason: fmt.Sprintf("状态码 %d", result.StatusCode)}
+		}
+		return &Outcome{Status: OutcomeSuccess}
+	}
+
+	for i := range e.Assert {
+		a := &e.Assert[i]
+		if err := a.check(result); err != nil {
+			return &Outcome{Status: OutcomeFailed, Assertion: a, Reason: err.Error()}
+		}
+	}
+	return &Outcome{Status: OutcomeSuccess}
+}
+
+// Failure 分类为失败时返回原因
+func (o *Outcome) Failure() error {
+	if o.Status != OutcomeFailed {
+		return nil
+	}
+	if o.Step != "" {
+		return fmt.Errorf("步骤 %s 失败: %s", o.Step, o.Reason)
+	}
+	return fmt.Errorf("%s", o.Reason)
+}
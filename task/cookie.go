@@ -0,0 +1,362 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieEntry cookie jar中的一条cookie，字段与Netscape cookie文件的列对应
+type cookieEntry struct {
+	domain     string
+	subdomains bool // 是否匹配子域名
+	path       string
+	secure     bool
+	httpOnly   bool
+	expires    int64 // Unix时间戳，0表示会话cookie
+	name       string
+	value      string
+}
+
+// cookieJar 兼容curl的cookie jar，实现http.CookieJar接口，
+// 可以读写Netscape格式的cookie文件
+type cookieJar struct {
+	mu      sync.Mutex
+	entries []*cookieEntry
+}
+
+// 按文件路径加锁，避免同一个jar被并发任务同时读写导致cookie丢失
+var (
+	jarLocksMu sync.Mutex
+	jarLocks   = make(map[string]*sync.Mutex)
+)
+
+// lockJarFile 锁定jar文件，返回解锁函数
+func lockJarFile(path string) func() {
+	jarLocksMu.Lock()
+	lock, ok := jarLocks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		jarLocks[path] = lock
+	}
+	jarLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// resolveCookieFile 将 -b/-c 中的jar名解析为cookie目录下的路径
+func resolveCookieFile(name string) (string, error) {
+	if curlOptions.CookieDir == "" {
+		return "", fmt.Errorf("未配置cookie目录，不允许使用cookie文件: %s", name)
+	}
+	return resolveInDir(curlOptions.CookieDir, name)
+}
+
+// loadFile 从Netscape格式的cookie文件加载cookie，文件不存在时与curl一样忽略
+func (j *cookieJar) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取cookie文件失败: %v", err)
+	}
+
+	now := time.Now().Unix()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 6 {
+			continue
+		}
+		value := ""
+		if len(fields) >= 7 {
+			value = fields[6]
+		}
+		expires, _ := strconv.ParseInt(fields[4], 10, 64)
+		if expires != 0 && expires < now {
+			continue
+		}
+
+		domain := strings.ToLower(fields[0])
+		entry := &cookieEntry{
+			domain:     strings.TrimPrefix(domain, "."),
+			subdomains: strings.EqualFold(fields[1], "TRUE") || strings.HasPrefix(domain, "."),
+			path:       fields[2],
+			secure:     strings.EqualFold(fields[3], "TRUE"),
+			httpOnly:   httpOnly,
+			expires:    expires,
+			name:       fields[5],
+			value:      value,
+		}
+		// 旧版本可能保存了公共后缀的cookie，只发送给该主机本身
+		if entry.subdomains && isPublicSuffix(entry.domain) {
+			entry.subdomains = false
+		}
+		j.set(entry)
+	}
+
+	return scanner.Err()
+}
+
+// saveFile 将jar中的cookie写入Netscape格式的cookie文件
+func (j *cookieJar) saveFile(path string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("# Netscape HTTP Cookie File\n")
+	buf.WriteString("# This file was generated by sign_agent! Edit at your own risk.\n\n")
+
+	now := time.Now().Unix()
+	for _, e := range j.entries {
+		if e.expires != 0 && e.expires < now {
+			continue
+		}
+
+		domain := e.domain
+		if e.subdomains {
+			domain = "." + domain
+		}
+		if e.httpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(e.subdomains), e.path, netscapeBool(e.secure), e.expires, e.name, e.value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建cookie目录失败: %v", err)
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致jar损坏
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("写入cookie文件失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入cookie文件失败: %v", err)
+	}
+
+	return nil
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// set 添加或替换domain、path、name都相同的cookie
+func (j *cookieJar) set(entry *cookieEntry) {
+	for i, e := range j.entries {
+		if e.domain == entry.domain && e.path == entry.path && e.name == entry.name {
+			j.entries[i] = entry
+			return
+		}
+	}
+	j.entries = append(j.entries, entry)
+}
+
+// remove 删除domain、path、name都相同的cookie
+func (j *cookieJar) remove(domain, path, name string) {
+	for i, e := range j.entries {
+		if e.domain == domain && e.path == path && e.name == name {
+			j.entries = append(j.entries[:i], j.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// isPublicSuffix 判断域名是否为公共后缀，如com、co.uk、github.io
+func isPublicSuffix(domain string) bool {
+	ps, _ := publicsuffix.PublicSuffix(domain)
+	return ps == domain
+}
+
+// SetCookies 实现http.CookieJar，保存响应中Set-Cookie设置的cookie
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := canonicalCookieHost(u.Hostname())
+	now := time.Now()
+
+	for _, c := range cookies {
+		entry := &cookieEntry{
+			domain:   host,
+			path:     c.Path,
+			secure:   c.Secure,
+			httpOnly: c.HttpOnly,
+			name:     c.Name,
+			value:    c.Value,
+		}
+
+		if c.Domain != "" {
+			domain := canonicalCookieHost(strings.TrimPrefix(c.Domain, "."))
+			// 拒绝为无关域名设置cookie
+			if !domainMatch(host, domain) {
+				continue
+			}
+			entry.domain = domain
+			entry.subdomains = net.ParseIP(domain) == nil
+
+			// 与net/http/cookiejar一样拒绝为公共后缀（如com、co.uk）设置cookie，
+			// 只有主机名本身就是公共后缀时作为只发送给该主机的cookie
+			if entry.subdomains && isPublicSuffix(domain) {
+				if host != domain {
+					continue
+				}
+				entry.subdomains = false
+			}
+		}
+
+		if entry.path == "" || !strings.HasPrefix(entry.path, "/") {
+			entry.path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			j.remove(entry.domain, entry.path, entry.name)
+			continue
+		case c.MaxAge > 0:
+			entry.expires = now.Add(time.Duration(c.MaxAge) * time.Second).Unix()
+		case !c.Expires.IsZero():
+			if !c.Expires.After(now) {
+				j.remove(entry.domain, entry.path, entry.name)
+				continue
+			}
+			entry.expires = c.Expires.Unix()
+		}
+
+		j.set(entry)
+	}
+}
+
+// Cookies 实现http.CookieJar，返回应随请求发送的cookie
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := canonicalCookieHost(u.Hostname())
+	reqPath := u.Path
+	if reqPath == "" {
+		reqPath = "/"
+	}
+	https := u.Scheme == "https"
+	now := time.Now().Unix()
+
+	var matched []*cookieEntry
+	for _, e := range j.entries {
+		if e.expires != 0 && e.expires < now {
+			continue
+		}
+		if e.secure && !https {
+			continue
+		}
+		if e.subdomains {
+			if !domainMatch(host, e.domain) {
+				continue
+			}
+		} else if host != e.domain {
+			continue
+		}
+		if !pathMatch(reqPath, e.path) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	// 与浏览器一样，路径更长的cookie排在前面
+	sort.SliceStable(matched, func(a, b int) bool {
+		return len(matched[a].path) > len(matched[b].path)
+	})
+
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, e := range matched {
+		cookies = append(cookies, &http.Cookie{Name: e.name, Value: e.value})
+	}
+	return cookies
+}
+
+func canonicalCookieHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// domainMatch 判断host是否等于domain或是domain的子域名
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch 按RFC 6265判断请求路径是否匹配cookie路径
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath 按RFC 6265计算Set-Cookie未指定Path时的默认路径
+func defaultCookiePath(reqPath string) string {
+	if reqPath == "" || reqPath[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(reqPath, "/")
+	if i == 0 {
+		return "/"
+	}
+	return reqPath[:i]
+}
+
+// lookup 查找名称为name的cookie，优先返回会随u发送的cookie，其次返回jar中其他域名或路径下的同名cookie
+func (j *cookieJar) lookup(u *url.URL, name string) (string, bool) {
+	if u != nil {
+		for _, c := range j.Cookies(u) {
+			if c.Name == name {
+				return c.Value, true
+			}
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].name == name {
+			return j.entries[i].value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,114 @@
+package task
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cookieNames 返回访问rawURL时jar发送的cookie名称
+func cookieNames(t *testing.T, jar *cookieJar, rawURL string) map[string]bool {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, c := range jar.Cookies(u) {
+		names[c.Name] = true
+	}
+	return names
+}
+
+func TestCookieJarRejectsPublicSuffixDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string // 设置cookie的响应的URL
+		domain  string // Set-Cookie中的Domain
+		sendTo  []string
+		notSent []string
+	}{
+		{
+			name:    "顶级域名",
+			from:    "https://a.example.com/",
+			domain:  "com",
+			notSent: []string{"https://a.example.com/", "https://other.com/"},
+		},
+		{
+			name:    "带点的顶级域名",
+			from:    "https://a.example.com/",
+			domain:  ".com",
+			notSent: []string{"https://a.example.com/", "https://other.com/"},
+		},
+		{
+			name:    "多级公共后缀",
+			from:    "https://a.example.co.uk/",
+			domain:  "co.uk",
+			notSent: []string{"https://a.example.co.uk/", "https://other.co.uk/"},
+		},
+		{
+			name:    "私有公共后缀",
+			from:    "https://alice.github.io/",
+			domain:  "github.io",
+			notSent: []string{"https://alice.github.io/", "https://bob.github.io/"},
+		},
+		{
+			name:    "注册域名",
+			from:    "https://a.example.co.uk/",
+			domain:  "example.co.uk",
+			sendTo:  []string{"https://a.example.co.uk/", "https://b.example.co.uk/", "https://example.co.uk/"},
+			notSent: []string{"https://other.co.uk/"},
+		},
+		{
+			// 主机名本身是公共后缀时作为只发送给该主机的cookie
+			name:    "主机名是公共后缀",
+			from:    "https://co.uk/",
+			domain:  "co.uk",
+			sendTo:  []string{"https://co.uk/"},
+			notSent: []string{"https://example.co.uk/"},
+		},
+	}
+	for _, tt := range tests {
+		jar := &cookieJar{}
+		from, err := url.Parse(tt.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jar.SetCookies(from, []*http.Cookie{{Name: "sid", Value: "1", Domain: tt.domain}})
+
+		for _, u := range tt.sendTo {
+			if !cookieNames(t, jar, u)["sid"] {
+				t.Errorf("%s: 应向 %s 发送cookie", tt.name, u)
+			}
+		}
+		for _, u := range tt.notSent {
+			if cookieNames(t, jar, u)["sid"] {
+				t.Errorf("%s: 不应向 %s 发送cookie", tt.name, u)
+			}
+		}
+	}
+}
+
+// 旧版本保存到文件中的公共后缀cookie只发送给该主机本身
+func TestCookieJarLoadPublicSuffixDomain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jar.txt")
+	data := ".com\tTRUE\t/\tFALSE\t0\tleak\t1\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsid\t2\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jar := &cookieJar{}
+	if err := jar.loadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	names := cookieNames(t, jar, "https://a.example.com/")
+	if names["leak"] {
+		t.Error("公共后缀的cookie不应发送给子域名")
+	}
+	if !names["sid"] {
+		t.Error("注册域名的cookie应发送给子域名")
+	}
+}
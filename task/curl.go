@@ -2,133 +2,652 @@
 package task
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mattn/go-shellwords"
 )
 
-// ExecuteCurlCommand 执行curl命令，安全地解析和执行curl请求
-func ExecuteCurlCommand(cmdStr string) (string, error) {
+// curlRequest 从curl命令中解析出的请求参数
+type curlRequest struct {
+	url       string
+	method    string
+	methodSet bool          // 是否通过 -X 显式指定了请求方法
+	headers   []headerField // -H 指定的请求头，保留顺序和重复项
+	data      []string      // 多个 -d 的数据，发送时用 & 连接
+	get       bool          // -G：将数据放入查询字符串
+	forms     []formField
+	insecure  bool
+
+	removedHeaders []string // -H "Name:" 移除的请求头
+	userAgent      string   // -A
+	referer        string   // -e
+	autoReferer    bool     // -e ";auto"：跟随重定向时自动设置Referer
+
+	cookies     []string   // -b 指定的 k=v 形式的cookie
+	cookieFiles []string   // -b 指定的cookie文件
+	cookieJar   string     // -c 指定的cookie文件，请求结束后写回
+	session     *cookieJar // 工作流各步骤共用的cookie，不为nil时cookie文件也加载到其中
+
+	followRedirects bool          // -L
+	maxRedirs       int           // --max-redirs，-1表示不限制
+	maxTime         time.Duration // -m，单次请求的最长时间
+	connectTimeout  time.Duration // --connect-timeout
+
+	retry           int           // --retry
+	retryDelay      time.Duration // --retry-delay，为0时使用指数退避
+	retryMaxTime    time.Duration // --retry-max-time
+	retryAllErrors  bool          // --retry-all-errors
+	retryConnRefuse bool          // --retry-connrefused
+
+	proxy      string // -x，为空且proxySet为true时表示直连
+	proxySet   bool
+	proxyUser  string // --proxy-user
+	noProxy    string // --noproxy
+	noProxySet bool
+
+	proxyCACert   string // --proxy-cacert，证书目录下HTTPS代理的CA证书
+	proxyInsecure bool   // --proxy-insecure，不校验HTTPS代理的证书
+
+	user     string   // -u 的用户名
+	password string   // -u 的密码
+	authType string   // --basic/--digest/--anyauth，默认为Basic
+	bearer   string   // --oauth2-bearer
+	secrets  []string // 需要在结果和错误信息中隐藏的凭据
+
+	cert          string // --cert，证书目录下的客户端证书
+	key           string // --key，证书目录下的私钥
+	keyPassphrase string // --cert file:passphrase 或 --pass
+	caCert        string // --cacert
+	caPath        string // --capath
+	pinnedPubKey  string // --pinnedpubkey
+	tlsMinVersion uint16 // --tlsv1.x
+	tlsMaxVersion uint16 // --tls-max
+	ciphers       string // --ciphers
+
+	includeHeaders bool       // -i：输出中包含响应头
+	headOnly       bool       // -I：只请求并输出响应头
+	outputToFile   bool       // -o：响应体不出现在标准输出中，agent不会写文件
+	writeOut       string     // -w：请求完成后输出的格式串
+	trace          *curlTrace // 当前请求尝试的时间记录
+
+	compressed bool // --compressed
+
+	resolves  []resolveEntry  // --resolve
+	connectTo []connectToRule // --connect-to
+	iface     string          // --interface
+	ipVersion string          // -4/-6
+}
+
+// curl默认最多跟随的重定向次数
+const defaultMaxRedirs = 50
+
+// curlArgOptions 需要参数值的curl选项
+var curlArgOptions = map[string]bool{
+	"--url": true, "-X": true, "--request": true, "-H": true, "--header": true,
+	"-A": true, "--user-agent": true, "-e": true, "--referer": true,
+	"-d": true, "--data": true, "--data-ascii": true, "--data-binary": true, "--data-raw": true, "--data-urlencode": true,
+	"-F": true, "--form": true, "--form-string": true,
+	"-b": true, "--cookie": true, "-c": true, "--cookie-jar": true,
+	"--max-redirs": true, "-m": true, "--max-time": true, "--connect-timeout": true,
+	"--retry": true, "--retry-delay": true, "--retry-max-time": true,
+	"-x": true, "--proxy": true, "-U": true, "--proxy-user": true, "--noproxy": true, "--proxy-cacert": true,
+	"-u": true, "--user": true, "--oauth2-bearer": true,
+	"-E": true, "--cert": true, "--key": true, "--pass": true, "--cacert": true, "--capath": true,
+	"--pinnedpubkey": true, "--tls-max": true, "--ciphers": true, "--cert-type": true, "--key-type": true,
+	"-w": true, "--write-out": true,
+	"--resolve": true, "--connect-to": true, "--interface": true,
+	// 以下选项不影响请求，只需跳过其参数
+	"-o": true, "--output": true, "-D": true, "--dump-header": true,
+	"--stderr": true, "--trace": true, "--trace-ascii": true,
+}
+
+// ExecuteCurlCommand 执行curl命令，安全地解析和执行curl请求，
+// 返回与curl标准输出一致的字符串（兼容旧版本的纯文本结果）
+func ExecuteCurlCommand(ctx context.Context, cmdStr string) (string, error) {
+	result, err := ExecuteCurl(ctx, cmdStr)
+	if err != nil {
+		return "", err
+	}
+	return result.Output, nil
+}
+
+// ExecuteCurl 执行curl命令，返回包含状态码、响应头、耗时等信息的结构化结果。
+// 命令中的 {{...}} 按原样发送；ctx取消时中止请求和重试等待
+func ExecuteCurl(ctx context.Context, cmdStr string) (*CurlResult, error) {
+	return executeCurl(ctx, cmdStr, false)
+}
+
+// executeCurl 执行curl命令，render为true时先计算参数中的模板
+func executeCurl(ctx context.Context, cmdStr string, render bool) (*CurlResult, error) {
 	// 安全检查：确保命令以curl开头
 	cmdStr = strings.TrimSpace(cmdStr)
 	if !strings.HasPrefix(cmdStr, "curl") {
-		return "", fmt.Errorf("命令必须以curl开头")
+		return nil, fmt.Errorf("命令必须以curl开头")
+	}
+
+	// 解析CURL命令并转换为HTTP请求
+	return executeHTTPRequest(ctx, cmdStr, render)
+}
+
+// CurlTask 执行一条curl命令，按断言对结果分类
+type CurlTask struct {
+	Command string `json:"command" desc:"curl命令，如 curl -X POST https://example.com/api/sign"`
+	// PlainOutput 为true时结果只包含与curl标准输出一致的字符串，兼容旧版本的控制端
+	PlainOutput bool `json:"plain_output,omitempty" desc:"为true时data只返回与curl标准输出一致的字符串"`
+	// Template 为true时在发送前计算命令中的 {{...}} 模板，默认按原样发送，
+	// 请求体等参数中字面的 {{ 不会被当作模板
+	Template bool `json:"template,omitempty" desc:"为true时发送前计算命令中的{{...}}模板函数，如{{now_unix}}、{{secret \"名称\"}}"`
+	// Expectation 断言（assert、already_done），决定结果的分类
+	Expectation
+}
+
+// Validate 检查断言的定义
+func (t *CurlTask) Validate() error {
+	if err := t.Expectation.Validate(); err != nil {
+		return fmt.Errorf("断言无效: %v", err)
 	}
+	return nil
+}
 
-	// 检查分号，防止多条命令执行
-	if strings.Contains(cmdStr, ";") {
-		return "", fmt.Errorf("不允许使用分号执行多条命令")
+// Execute 执行curl命令，断言不满足时在结果中返回失败原因
+func (t *CurlTask) Execute(ctx context.Context) (*Result, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	result, err := executeCurl(ctx, t.Command, t.Template)
+	if err != nil {
+		return nil, fmt.Errorf("执行curl命令失败: %v", err)
 	}
 
-	// 解析CURL命令并转换为HTTP请求
-	return executeHTTPRequest(cmdStr)
+	res := &Result{Data: result, Outcome: t.Expectation.Classify(result)}
+	if t.PlainOutput {
+		res.Data = result.Output
+	}
+	if failure := res.Outcome.Failure(); failure != nil {
+		res.Failure = fmt.Errorf("curl任务失败: %v", failure)
+	}
+	return res, nil
 }
 
-// executeHTTPRequest 执行HTTP请求，处理复杂的curl命令解析
-func executeHTTPRequest(curlCmd string) (string, error) {
-	// 初始化HTTP请求参数
-	url := ""
-	method := "GET"
-	headers := make(map[string]string)
-	data := ""
-	insecure := false
-
-	// 使用更复杂的解析逻辑提取curl参数
-	// 正确处理引号和转义
-	parts, err := shellwords.Parse(curlCmd)
+// Redacted 返回隐藏了凭据的curl命令
+func (t *CurlTask) Redacted() string {
+	return RedactCurlCommand(t.Command)
+}
+
+// Hosts 返回curl命令请求的主机
+func (t *CurlTask) Hosts() []string {
+	if host := curlHost(t.Command); host != "" {
+		return []string{host}
+	}
+	return nil
+}
+
+// curlHost 返回curl命令中URL的主机名，不计算模板函数。
+// 命令无效或主机名包含模板时返回空字符串
+func curlHost(curlCmd string) string {
+	parts, err := splitCurlCommand(strings.TrimSpace(curlCmd))
 	if err != nil {
-		return "", fmt.Errorf("解析curl命令失败: %v", err)
+		return ""
+	}
+	for i := 1; i < len(parts); i++ {
+		arg := parts[i]
+		switch {
+		case arg == "--url" && i+1 < len(parts):
+			return urlHost(parts[i+1])
+		case curlArgOptions[arg]:
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			return urlHost(arg)
+		}
 	}
+	return ""
+}
 
-	if len(parts) < 2 {
-		return "", fmt.Errorf("无效的curl命令")
+// urlHost 返回URL的主机名
+func urlHost(rawURL string) string {
+	if strings.Contains(rawURL, "{{") {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// parseCurlCommand 解析curl命令行，正确处理引号和转义
+func parseCurlCommand(curlCmd string) (*curlRequest, error) {
+	parts, err := splitCurlCommand(curlCmd)
+	if err != nil {
+		return nil, err
 	}
 
 	// 跳过第一个元素(curl命令本身)
-	for i := 1; i < len(parts); i++ {
+	return parseCurlArgs(parts[1:])
+}
+
+// splitCurlCommand 按shell规则拆分curl命令行，返回包含curl本身的参数列表
+func splitCurlCommand(curlCmd string) ([]string, error) {
+	// 从浏览器开发者工具复制的命令常用反斜杠换行分隔多行
+	curlCmd = strings.NewReplacer("\\\r\n", " ", "\\\n", " ").Replace(curlCmd)
+
+	parser := shellwords.NewParser()
+	parts, err := parser.Parse(curlCmd)
+	if err != nil {
+		return nil, fmt.Errorf("解析curl命令失败: %v", err)
+	}
+
+	// 检查未加引号的分号、管道等控制符，防止多条命令执行；
+	// 引号内的分号（如 -F "file=@a.txt;type=text/plain"）是合法参数
+	if parser.Position != -1 {
+		return nil, fmt.Errorf("不允许使用分号等控制符执行多条命令")
+	}
+
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("无效的curl命令")
+	}
+	return parts, nil
+}
+
+// parseCurlArgs 解析已经拆分好的curl参数（不含curl本身）
+func parseCurlArgs(parts []string) (*curlRequest, error) {
+	req := &curlRequest{
+		method:    "GET",
+		maxRedirs: defaultMaxRedirs,
+	}
+
+	for i := 0; i < len(parts); i++ {
 		arg := parts[i]
 
 		// 处理URL (非选项参数)
-		if !strings.HasPrefix(arg, "-") && url == "" {
-			url = arg
+		if !strings.HasPrefix(arg, "-") {
+			if req.url == "" {
+				req.url = arg
+			}
 			continue
 		}
 
-		// 处理选项
-		switch arg {
-		case "-X", "--request":
-			if i+1 < len(parts) {
-				method = parts[i+1]
-				i++
+		// 读取选项的参数值，支持 -XPOST 这样紧跟在短选项后的写法
+		var value string
+		if curlArgOptions[arg] {
+			if i+1 >= len(parts) {
+				return nil, fmt.Errorf("选项 %s 缺少参数", arg)
 			}
-		case "-H", "--header":
-			if i+1 < len(parts) {
-				headerLine := parts[i+1]
-				if colonIdx := strings.Index(headerLine, ":"); colonIdx != -1 {
-					name := strings.TrimSpace(headerLine[:colonIdx])
-					value := strings.TrimSpace(headerLine[colonIdx+1:])
-					headers[name] = value
-				}
-				i++
+			i++
+			value = parts[i]
+		} else if len(arg) > 2 && arg[1] != '-' && curlArgOptions[arg[:2]] {
+			arg, value = arg[:2], arg[2:]
+		}
+
+		if err := req.applyOption(arg, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.url == "" {
+		return nil, fmt.Errorf("未指定URL")
+	}
+	req.extractURLCredentials()
+
+	if len(req.data) > 0 && len(req.forms) > 0 {
+		return nil, fmt.Errorf("不能同时使用 -d 和 -F 发送数据")
+	}
+	if req.get && len(req.forms) > 0 {
+		return nil, fmt.Errorf("不能同时使用 -G 和 -F")
+	}
+
+	// -G 将数据以查询字符串的形式追加到URL
+	if req.get {
+		if len(req.data) > 0 {
+			sep := "?"
+			if strings.Contains(req.url, "?") {
+				sep = "&"
 			}
-		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw":
-			if i+1 < len(parts) {
-				data = parts[i+1]
-				// 如果没有明确指定方法，数据请求默认为POST
-				if method == "GET" {
-					method = "POST"
-				}
-				i++
+			req.url += sep + strings.Join(req.data, "&")
+			req.data = nil
+		}
+		if !req.methodSet {
+			req.method = "GET"
+		}
+	}
+
+	// 如果没有明确指定方法，发送数据的请求默认为POST
+	if !req.methodSet && (len(req.data) > 0 || len(req.forms) > 0) {
+		req.method = "POST"
+	}
+	if req.headOnly {
+		if len(req.data) > 0 || len(req.forms) > 0 {
+			return nil, fmt.Errorf("不能同时使用 -I 和 -d/-F")
+		}
+		if !req.methodSet {
+			req.method = "HEAD"
+		}
+	}
+
+	return req, nil
+}
+
+// applyOption 处理单个curl选项，未知选项直接忽略
+func (r *curlRequest) applyOption(opt, value string) error {
+	var err error
+
+	switch opt {
+	case "--url":
+		r.url = value
+	case "-X", "--request":
+		r.method = value
+		r.methodSet = true
+	case "-H", "--header":
+		return r.addHeader(value)
+	case "-A", "--user-agent":
+		r.userAgent = value
+	case "-e", "--referer":
+		r.setReferer(value)
+	case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+		data, err := parseDataArg(opt, value)
+		if err != nil {
+			return err
+		}
+		r.data = append(r.data, data)
+	case "-G", "--get":
+		r.get = true
+	case "-F", "--form", "--form-string":
+		field, err := parseFormField(value, opt == "--form-string")
+		if err != nil {
+			return err
+		}
+		r.forms = append(r.forms, field)
+	case "-b", "--cookie":
+		// 与curl一样，包含等号的参数视为cookie字符串，否则视为cookie文件
+		if strings.Contains(value, "=") {
+			r.cookies = append(r.cookies, value)
+		} else {
+			r.cookieFiles = append(r.cookieFiles, value)
+		}
+	case "-c", "--cookie-jar":
+		r.cookieJar = value
+	case "-k", "--insecure":
+		r.insecure = true
+	case "-L", "--location":
+		r.followRedirects = true
+	case "--max-redirs":
+		r.maxRedirs, err = parseIntOption(opt, value)
+	case "-m", "--max-time":
+		r.maxTime, err = parseSecondsOption(opt, value)
+	case "--connect-timeout":
+		r.connectTimeout, err = parseSecondsOption(opt, value)
+	case "--retry":
+		r.retry, err = parseIntOption(opt, value)
+	case "--retry-delay":
+		r.retryDelay, err = parseSecondsOption(opt, value)
+	case "--retry-max-time":
+		r.retryMaxTime, err = parseSecondsOption(opt, value)
+	case "--retry-all-errors":
+		r.retryAllErrors = true
+	case "--retry-connrefused":
+		r.retryConnRefuse = true
+	case "-x", "--proxy":
+		r.proxy = value
+		r.proxySet = true
+		if u, err := parseProxyURL(value); err == nil && u.User != nil {
+			password, _ := u.User.Password()
+			r.addSecret(password)
+		}
+	case "-U", "--proxy-user":
+		r.proxyUser = value
+		if _, pass, ok := strings.Cut(value, ":"); ok {
+			r.addSecret(pass)
+		}
+	case "--noproxy":
+		r.noProxy = value
+		r.noProxySet = true
+	case "--proxy-cacert":
+		r.proxyCACert = value
+	case "--proxy-insecure":
+		r.proxyInsecure = true
+	case "-u", "--user":
+		r.setUser(value)
+	case "--basic":
+		r.authType = authBasic
+	case "--digest":
+		r.authType = authDigest
+	case "--anyauth":
+		r.authType = authAny
+	case "--oauth2-bearer":
+		r.bearer = value
+		r.addSecret(value)
+	case "-E", "--cert":
+		cert, passphrase := splitCertPassphrase(value)
+		r.cert = cert
+		if passphrase != "" {
+			r.keyPassphrase = passphrase
+			r.addSecret(passphrase)
+		}
+	case "--key":
+		r.key = value
+	case "--pass":
+		r.keyPassphrase = value
+		r.addSecret(value)
+	case "--cert-type", "--key-type":
+		if !strings.EqualFold(value, "PEM") {
+			return fmt.Errorf("仅支持PEM格式的证书和私钥")
+		}
+	case "--cacert":
+		r.caCert = value
+	case "--capath":
+		r.caPath = value
+	case "--pinnedpubkey":
+		r.pinnedPubKey = value
+	case "--tlsv1", "--tlsv1.0", "--tlsv1.1", "--tlsv1.2", "--tlsv1.3":
+		r.tlsMinVersion = tlsVersions[opt]
+	case "--tls-max":
+		version, ok := tlsVersions["--tlsv"+value]
+		if !ok {
+			return fmt.Errorf("选项 %s 的值无效: %s", opt, value)
+		}
+		r.tlsMaxVersion = version
+	case "--ciphers":
+		r.ciphers = value
+	case "-i", "--include":
+		r.includeHeaders = true
+	case "-I", "--head":
+		r.headOnly = true
+	case "--compressed":
+		r.compressed = true
+	case "--resolve":
+		entry, err := parseResolve(value)
+		if err != nil {
+			return err
+		}
+		r.resolves = append(r.resolves, entry)
+	case "--connect-to":
+		rule, err := parseConnectTo(value)
+		if err != nil {
+			return err
+		}
+		r.connectTo = append(r.connectTo, rule)
+	case "--interface":
+		r.iface = value
+	case "-4", "--ipv4":
+		r.ipVersion = "4"
+	case "-6", "--ipv6":
+		r.ipVersion = "6"
+	case "-o", "--output":
+		r.outputToFile = true
+	case "-w", "--write-out":
+		// 与curl一样，@file 表示从文件读取格式串
+		if strings.HasPrefix(value, "@") {
+			content, err := readDataFile(value[1:])
+			if err != nil {
+				return err
 			}
-		case "-k", "--insecure":
-			insecure = true
+			value = string(content)
 		}
+		r.writeOut = value
+	}
+
+	return err
+}
+
+// parseIntOption 解析整数类型的选项值
+func parseIntOption(opt, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("选项 %s 的值无效: %s", opt, value)
 	}
+	return n, nil
+}
 
-	if url == "" {
-		return "", fmt.Errorf("未指定URL")
+// parseSecondsOption 解析以秒为单位的时间选项，与curl一样支持小数
+func parseSecondsOption(opt, value string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("选项 %s 的值无效: %s", opt, value)
 	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
 
-	// 创建HTTP客户端
-	client := &http.Client{}
-	if insecure {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// buildBody 根据解析结果构造请求体，返回请求体和对应的Content-Type
+func (r *curlRequest) buildBody() ([]byte, string, error) {
+	if len(r.forms) > 0 {
+		return buildMultipartBody(r.forms)
+	}
+	if len(r.data) > 0 {
+		return []byte(strings.Join(r.data, "&")), "application/x-www-form-urlencoded", nil
+	}
+	return nil, "", nil
+}
+
+// executeHTTPRequest 执行HTTP请求，处理复杂的curl命令解析
+func executeHTTPRequest(ctx context.Context, curlCmd string, render bool) (*CurlResult, error) {
+	parts, err := splitCurlCommand(curlCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// 发送前计算参数中的模板函数，如 {{now_unix}}、{{secret "name"}}，拆分参数后再渲染，结果不会改变参数的划分
+	var resolved []string
+	args := parts[1:]
+	if render {
+		if args, err = templateVars(nil).renderAll(args, &resolved); err != nil {
+			return nil, maskError(err, resolved)
 		}
 	}
 
-	// 创建请求
-	req, err := http.NewRequest(method, url, strings.NewReader(data))
+	cr, err := parseCurlArgs(args)
 	if err != nil {
-		return "", fmt.Errorf("创建HTTP请求失败: %v", err)
+		return nil, maskError(err, resolved)
+	}
+	for _, secret := range resolved {
+		cr.addSecret(secret)
 	}
 
-	// 添加头信息
-	for name, value := range headers {
-		req.Header.Add(name, value)
+	result, err := cr.execute(ctx)
+	if err != nil {
+		return nil, err
 	}
+	maskResult(result, cr.secrets)
+	return result, nil
+}
+
+// execute 发送解析好的请求并构造结构化结果
+func (cr *curlRequest) execute(ctx context.Context) (result *CurlResult, err error) {
+	// 返回的错误中不能包含密码、令牌等凭据
+	defer func() {
+		err = cr.maskError(err)
+	}()
 
-	// 如果是POST请求且未指定Content-Type，添加默认值
-	if (method == "POST" || method == "PUT") && data != "" && req.Header.Get("Content-Type") == "" {
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, contentType, err := cr.buildBody()
+	if err != nil {
+		return nil, err
 	}
 
-	// 执行请求
-	resp, err := client.Do(req)
+	// 加载cookie文件，同一个jar在请求完成并写回之前保持锁定
+	jar, jarPath, unlock, err := cr.openCookieJar()
 	if err != nil {
-		return "", fmt.Errorf("执行HTTP请求失败: %v", err)
+		return nil, err
+	}
+	if unlock != nil {
+		defer unlock()
 	}
-	defer resp.Body.Close()
 
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
+	// 创建HTTP客户端
+	client, err := cr.newClient()
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %v", err)
+		return nil, err
+	}
+	if jar != nil {
+		client.Jar = jar
+	}
+
+	// 执行请求，按 --retry 相关选项重试
+	resp, respBody, retries, err := cr.doWithRetry(ctx, client, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// 将服务器设置的cookie写回jar文件
+	if jarPath != "" {
+		if err := jar.saveFile(jarPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// 解压响应体并转换为UTF-8
+	rawSize := len(respBody)
+	if respBody, err = cr.decompressBody(resp, respBody); err != nil {
+		return nil, err
+	}
+	respBody, charsetName := convertToUTF8(resp.Header.Get("Content-Type"), respBody)
+
+	result = cr.newCurlResult(resp, respBody, rawSize, retries)
+	result.Charset = charsetName
+	return result, nil
+}
+
+// openCookieJar 在使用了 -b 文件或 -c 时创建cookie jar并加载cookie文件（工作流中使用共用的jar），
+// 返回jar、需要写回的文件路径和解锁函数
+func (r *curlRequest) openCookieJar() (*cookieJar, string, func(), error) {
+	if len(r.cookieFiles) == 0 && r.cookieJar == "" {
+		return r.session, "", nil, nil
+	}
+
+	jar := r.session
+	if jar == nil {
+		jar = &cookieJar{}
+	}
+	var jarPath string
+	var unlock func()
+
+	if r.cookieJar != "" {
+		path, err := resolveCookieFile(r.cookieJar)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		jarPath = path
+		unlock = lockJarFile(path)
+	}
+
+	for _, name := range r.cookieFiles {
+		path, err := resolveCookieFile(name)
+		if err != nil {
+			if unlock != nil {
+				unlock()
+			}
+			return nil, "", nil, err
+		}
+		if err := jar.loadFile(path); err != nil {
+			if unlock != nil {
+				unlock()
+			}
+			return nil, "", nil, err
+		}
 	}
 
-	return string(body), nil
+	return jar, jarPath, unlock, nil
 }
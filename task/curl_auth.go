@@ -0,0 +1,250 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 认证方式
+const (
+	authBasic  = "basic"
+	authDigest = "digest"
+	authAny    = "any" // --anyauth：根据服务器的质询选择Digest或Basic
+)
+
+// 日志和错误信息中用于替换凭据的占位符
+const secretMask = "******"
+
+// setUser 处理 -u user:pass，未指定密码时使用空密码
+func (r *curlRequest) setUser(value string) {
+	user, pass, _ := strings.Cut(value, ":")
+	r.user, r.password = user, pass
+	r.addSecret(pass)
+}
+
+// addSecret 记录需要在结果和错误信息中隐藏的凭据
+func (r *curlRequest) addSecret(secret string) {
+	if secret != "" {
+		r.secrets = append(r.secrets, secret)
+	}
+}
+
+// extractURLCredentials 与curl一样，把URL中的 user:pass@ 作为 -u 的凭据，并从URL中移除
+func (r *curlRequest) extractURLCredentials() {
+	u, err := url.Parse(r.url)
+	if err != nil || u.User == nil {
+		return
+	}
+
+	if r.user == "" {
+		r.user = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if password, ok := u.User.Password(); ok {
+		r.addSecret(password)
+		r.addSecret(url.QueryEscape(password))
+	}
+
+	u.User = nil
+	r.url = u.String()
+}
+
+// maskSecrets 将文本中出现的凭据替换为占位符
+func (r *curlRequest) maskSecrets(s string) string {
+	return maskText(s, r.secrets)
+}
+
+// maskError 隐藏错误信息中的凭据
+func (r *curlRequest) maskError(err error) error {
+	return maskError(err, r.secrets)
+}
+
+// applyAuth 在请求上设置预先可确定的认证头：Bearer令牌或Basic认证。
+// Digest和 --anyauth 需要先拿到服务器的质询，由 authenticate 处理
+func (r *curlRequest) applyAuth(req *http.Request) {
+	if r.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+r.bearer)
+		return
+	}
+	if r.user != "" && (r.authType == "" || r.authType == authBasic) {
+		req.SetBasicAuth(r.user, r.password)
+	}
+}
+
+// needsChallenge 判断是否需要根据401质询再次发送带认证的请求
+func (r *curlRequest) needsChallenge() bool {
+	return r.bearer == "" && r.user != "" && (r.authType == authDigest || r.authType == authAny)
+}
+
+// authenticate 根据401响应中的质询为重发的请求设置认证头，无法处理时返回false
+func (r *curlRequest) authenticate(resp *http.Response, req *http.Request, body []byte) bool {
+	challenges := resp.Header.Values("WWW-Authenticate")
+
+	if challenge := selectDigestChallenge(challenges); challenge != nil {
+		header, err := r.digestAuthorization(challenge, req.Method, req.URL.RequestURI(), body)
+		if err != nil {
+			return false
+		}
+		req.Header.Set("Authorization", header)
+		return true
+	}
+
+	if r.authType == authAny {
+		for _, c := range challenges {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(c)), "basic") {
+				req.SetBasicAuth(r.user, r.password)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectDigestChallenge 从质询中选出Digest质询，优先使用SHA-256
+func selectDigestChallenge(challenges []string) map[string]string {
+	var selected map[string]string
+	for _, c := range challenges {
+		c = strings.TrimSpace(c)
+		if len(c) < 7 || !strings.EqualFold(c[:7], "digest ") {
+			continue
+		}
+		params := parseAuthParams(c[7:])
+		algorithm := strings.ToUpper(params["algorithm"])
+		switch algorithm {
+		case "", "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		default:
+			continue
+		}
+		if selected == nil || strings.HasPrefix(algorithm, "SHA-256") {
+			selected = params
+		}
+	}
+	return selected
+}
+
+// parseAuthParams 解析质询中逗号分隔的 key=value 参数，值可以带引号
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eqIdx := strings.Index(s, "=")
+		if eqIdx <= 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eqIdx]))
+		s = strings.TrimLeft(s[eqIdx+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			var sb strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteByte(s[i])
+			}
+			value = sb.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else if comma := strings.Index(s, ","); comma != -1 {
+			value, s = strings.TrimSpace(s[:comma]), s[comma:]
+		} else {
+			value, s = strings.TrimSpace(s), ""
+		}
+		params[key] = value
+	}
+}
+
+// digestAuthorization 按RFC 7616计算Digest认证的Authorization头
+func (r *curlRequest) digestAuthorization(challenge map[string]string, method, uri string, body []byte) (string, error) {
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", err
+	}
+	return r.digestHeader(challenge, method, uri, body, hex.EncodeToString(cnonceBytes))
+}
+
+// digestHeader 使用指定的客户端随机数计算Authorization头，每个质询只发送一次，nc固定为1
+func (r *curlRequest) digestHeader(challenge map[string]string, method, uri string, body []byte, cnonce string) (string, error) {
+	algorithm := challenge["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		newHash = md5.New
+	}
+	h := func(s string) string {
+		hasher := newHash()
+		hasher.Write([]byte(s))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	realm, nonce := challenge["realm"], challenge["nonce"]
+	const nc = "00000001"
+
+	ha1 := h(r.user + ":" + realm + ":" + r.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+
+	// 服务器同时支持时优先使用 auth，与curl一致
+	qop := ""
+	if qopOptions := challenge["qop"]; qopOptions != "" {
+		for _, q := range strings.Split(qopOptions, ",") {
+			q = strings.TrimSpace(q)
+			if q == "auth" {
+				qop = "auth"
+				break
+			}
+			if q == "auth-int" {
+				qop = "auth-int"
+			}
+		}
+		if qop == "" {
+			return "", fmt.Errorf("不支持的Digest qop: %s", qopOptions)
+		}
+	}
+
+	ha2 := h(method + ":" + uri)
+	if qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		quoteEscape(r.user), quoteEscape(realm), quoteEscape(nonce), uri, algorithm, response)
+	if qop != "" {
+		fmt.Fprintf(&sb, `, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		fmt.Fprintf(&sb, `, opaque="%s"`, quoteEscape(opaque))
+	}
+	return sb.String(), nil
+}
+
+func quoteEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
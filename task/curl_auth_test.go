@@ -0,0 +1,290 @@
+package task
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RFC 7616 §3.9.1 示例中的参数
+const (
+	rfcUser     = "Mufasa"
+	rfcPassword = "Circle of Life"
+	rfcRealm    = "http-auth@example.org"
+	rfcNonce    = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+	rfcOpaque   = "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"
+	rfcCnonce   = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	rfcURI      = "/dir/index.html"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// digestParams 解析Authorization头中Digest之后的参数
+func digestParams(t *testing.T, header string) map[string]string {
+	t.Helper()
+	if !strings.HasPrefix(header, "Digest ") {
+		t.Fatalf("不是Digest认证头: %s", header)
+	}
+	return parseAuthParams(strings.TrimPrefix(header, "Digest "))
+}
+
+func TestDigestRFC7616(t *testing.T) {
+	tests := []struct {
+		algorithm, response string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	r := &curlRequest{user: rfcUser, password: rfcPassword}
+	for _, tt := range tests {
+		challenge := map[string]string{
+			"realm":     rfcRealm,
+			"qop":       "auth, auth-int",
+			"algorithm": tt.algorithm,
+			"nonce":     rfcNonce,
+			"opaque":    rfcOpaque,
+		}
+		header, err := r.digestHeader(challenge, http.MethodGet, rfcURI, nil, rfcCnonce)
+		if err != nil {
+			t.Fatalf("%s 返回错误: %v", tt.algorithm, err)
+		}
+		params := digestParams(t, header)
+		want := map[string]string{
+			"username":  rfcUser,
+			"realm":     rfcRealm,
+			"nonce":     rfcNonce,
+			"uri":       rfcURI,
+			"algorithm": tt.algorithm,
+			"response":  tt.response,
+			"qop":       "auth",
+			"nc":        "00000001",
+			"cnonce":    rfcCnonce,
+			"opaque":    rfcOpaque,
+		}
+		for k, v := range want {
+			if params[k] != v {
+				t.Errorf("%s: %s = %q, 期望 %q", tt.algorithm, k, params[k], v)
+			}
+		}
+	}
+}
+
+func TestDigestVariants(t *testing.T) {
+	const (
+		user, password = "alice", `pa"ss`
+		realm, nonce   = `test "realm"`, "abc123"
+		cnonce         = "0a4f113b"
+		method, uri    = http.MethodPost, "/api/sign?x=1"
+		body           = `{"a":1}`
+	)
+	ha1 := md5Hex(user + ":" + realm + ":" + password)
+	ha1Sess := md5Hex(ha1 + ":" + nonce + ":" + cnonce)
+	ha2 := md5Hex(method + ":" + uri)
+	ha2Int := md5Hex(method + ":" + uri + ":" + md5Hex(body))
+	sha1 := sha256Hex(user + ":" + realm + ":" + password)
+	shaSess := sha256Hex(sha1 + ":" + nonce + ":" + cnonce)
+	shaHa2 := sha256Hex(method + ":" + uri)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		qop       string
+		wantQop   string
+		response  string
+	}{
+		// 没有qop时按RFC 2069计算
+		{"无qop", "", "", "", md5Hex(ha1 + ":" + nonce + ":" + ha2)},
+		{"MD5", "MD5", "auth", "auth", md5Hex(ha1 + ":" + nonce + ":00000001:" + cnonce + ":auth:" + ha2)},
+		{"MD5-sess", "MD5-sess", "auth", "auth", md5Hex(ha1Sess + ":" + nonce + ":00000001:" + cnonce + ":auth:" + ha2)},
+		{"auth-int", "MD5", "auth-int", "auth-int", md5Hex(ha1 + ":" + nonce + ":00000001:" + cnonce + ":auth-int:" + ha2Int)},
+		{"同时支持时优先auth", "MD5", "auth-int,auth", "auth", md5Hex(ha1 + ":" + nonce + ":00000001:" + cnonce + ":auth:" + ha2)},
+		{"SHA-256-sess", "SHA-256-sess", "auth", "auth", sha256Hex(shaSess + ":" + nonce + ":00000001:" + cnonce + ":auth:" + shaHa2)},
+	}
+	r := &curlRequest{user: user, password: password}
+	for _, tt := range tests {
+		challenge := map[string]string{"realm": realm, "nonce": nonce}
+		if tt.algorithm != "" {
+			challenge["algorithm"] = tt.algorithm
+		}
+		if tt.qop != "" {
+			challenge["qop"] = tt.qop
+		}
+		header, err := r.digestHeader(challenge, method, uri, []byte(body), cnonce)
+		if err != nil {
+			t.Fatalf("%s 返回错误: %v", tt.name, err)
+		}
+		params := digestParams(t, header)
+		if params["response"] != tt.response {
+			t.Errorf("%s: response = %s, 期望 %s", tt.name, params["response"], tt.response)
+		}
+		if params["qop"] != tt.wantQop {
+			t.Errorf("%s: qop = %q, 期望 %q", tt.name, params["qop"], tt.wantQop)
+		}
+		if params["realm"] != realm {
+			t.Errorf("%s: 带引号的realm = %q", tt.name, params["realm"])
+		}
+		if tt.wantQop == "" && (params["nc"] != "" || params["cnonce"] != "") {
+			t.Errorf("%s: 没有qop时不应发送nc和cnonce: %s", tt.name, header)
+		}
+	}
+
+	if _, err := r.digestHeader(map[string]string{"nonce": nonce, "qop": "auth-conf"}, method, uri, nil, cnonce); err == nil {
+		t.Error("不支持的qop应返回错误")
+	}
+}
+
+func TestSelectDigestChallenge(t *testing.T) {
+	tests := []struct {
+		name       string
+		challenges []string
+		want       string // 选中质询的algorithm，"-"表示没有可用的质询
+	}{
+		{"优先SHA-256", []string{`Digest realm="r", nonce="1", algorithm=MD5`, `Digest realm="r", nonce="2", algorithm=SHA-256`}, "SHA-256"},
+		{"SHA-256在前", []string{`Digest realm="r", nonce="2", algorithm=SHA-256`, `Digest realm="r", nonce="1", algorithm=MD5`}, "SHA-256"},
+		{"默认MD5", []string{`Basic realm="r"`, `digest realm="r", nonce="1"`}, ""},
+		{"跳过不支持的算法", []string{`Digest realm="r", nonce="1", algorithm=SHA-512-256`, `Digest realm="r", nonce="2", algorithm=MD5-sess`}, "MD5-sess"},
+		{"只有Basic", []string{`Basic realm="r"`}, "-"},
+		{"只有不支持的算法", []string{`Digest realm="r", nonce="1", algorithm=SHA-512-256`}, "-"},
+	}
+	for _, tt := range tests {
+		got := selectDigestChallenge(tt.challenges)
+		if tt.want == "-" {
+			if got != nil {
+				t.Errorf("%s: 应没有可用的质询, 得到 %v", tt.name, got)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%s: 没有选中质询", tt.name)
+			continue
+		}
+		if got["algorithm"] != tt.want {
+			t.Errorf("%s: algorithm = %q, 期望 %q", tt.name, got["algorithm"], tt.want)
+		}
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	got := parseAuthParams(`realm="a, \"b\"",nonce=xyz , qop="auth,auth-int", Opaque=""`)
+	want := map[string]string{
+		"realm":  `a, "b"`,
+		"nonce":  "xyz",
+		"qop":    "auth,auth-int",
+		"opaque": "",
+	}
+	if len(got) != len(want) {
+		t.Errorf("得到 %v, 期望 %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, 期望 %q", k, got[k], v)
+		}
+	}
+}
+
+// authServer 模拟需要认证的服务器，challenges为401响应中的质询
+type authServer struct {
+	challenges []string
+	mu         sync.Mutex
+	auths      []string // 每个请求的Authorization头
+}
+
+func (s *authServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	auth := req.Header.Get("Authorization")
+	s.mu.Lock()
+	s.auths = append(s.auths, auth)
+	s.mu.Unlock()
+
+	if s.verify(req.Method, auth) {
+		w.Write([]byte("ok"))
+		return
+	}
+	for _, c := range s.challenges {
+		w.Header().Add("WWW-Authenticate", c)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// verify 检查Basic或Digest认证的用户名和密码
+func (s *authServer) verify(method, auth string) bool {
+	if user, pass, ok := (&http.Request{Header: http.Header{"Authorization": {auth}}}).BasicAuth(); ok {
+		return user == rfcUser && pass == rfcPassword
+	}
+	if !strings.HasPrefix(auth, "Digest ") {
+		return false
+	}
+	p := parseAuthParams(strings.TrimPrefix(auth, "Digest "))
+	h := md5Hex
+	if p["algorithm"] == "SHA-256" {
+		h = sha256Hex
+	}
+	ha1 := h(p["username"] + ":" + p["realm"] + ":" + rfcPassword)
+	ha2 := h(method + ":" + p["uri"])
+	want := h(strings.Join([]string{ha1, p["nonce"], p["nc"], p["cnonce"], p["qop"], ha2}, ":"))
+	return p["username"] == rfcUser && p["nonce"] == rfcNonce && p["response"] == want
+}
+
+func TestCurlDigestChallenge(t *testing.T) {
+	digestMD5 := `Digest realm="` + rfcRealm + `", qop="auth", algorithm=MD5, nonce="` + rfcNonce + `"`
+	digestSHA := `Digest realm="` + rfcRealm + `", qop="auth", algorithm=SHA-256, nonce="` + rfcNonce + `"`
+	basic := `Basic realm="` + rfcRealm + `"`
+
+	tests := []struct {
+		name       string
+		options    string
+		password   string
+		challenges []string
+		wantStatus int
+		wantAuths  []string // 每个请求的认证方式和Digest算法，""表示没有Authorization头
+	}{
+		{"Digest", "--digest", rfcPassword, []string{digestMD5}, 200, []string{"", "Digest"}},
+		{"Digest优先SHA-256", "--digest", rfcPassword, []string{digestMD5, digestSHA}, 200, []string{"", "Digest SHA-256"}},
+		{"Digest密码错误", "--digest", "wrong", []string{digestMD5}, 401, []string{"", "Digest"}},
+		// 服务器只支持Basic时 --digest 不会发送密码
+		{"Digest遇到Basic质询", "--digest", rfcPassword, []string{basic}, 401, []string{""}},
+		{"anyauth选择Digest", "--anyauth", rfcPassword, []string{basic, digestSHA}, 200, []string{"", "Digest SHA-256"}},
+		{"anyauth选择Basic", "--anyauth", rfcPassword, []string{basic}, 200, []string{"", "Basic"}},
+		{"默认Basic", "", rfcPassword, []string{basic}, 200, []string{"Basic"}},
+	}
+	for _, tt := range tests {
+		srv := &authServer{challenges: tt.challenges}
+		ts := httptest.NewServer(srv)
+		cmd := "curl " + tt.options + " -u '" + rfcUser + ":" + tt.password + "' " + ts.URL + rfcURI
+		result, err := ExecuteCurl(context.Background(), cmd)
+		ts.Close()
+		if err != nil {
+			t.Errorf("%s 返回错误: %v", tt.name, err)
+			continue
+		}
+		if result.StatusCode != tt.wantStatus {
+			t.Errorf("%s: 状态码 %d, 期望 %d", tt.name, result.StatusCode, tt.wantStatus)
+		}
+		if len(srv.auths) != len(tt.wantAuths) {
+			t.Errorf("%s: 发送了%d个请求 %q, 期望%d个", tt.name, len(srv.auths), srv.auths, len(tt.wantAuths))
+			continue
+		}
+		for i, auth := range srv.auths {
+			scheme, params, _ := strings.Cut(auth, " ")
+			if algorithm := parseAuthParams(params)["algorithm"]; scheme == "Digest" && algorithm != "MD5" {
+				scheme += " " + algorithm
+			}
+			if scheme != tt.wantAuths[i] {
+				t.Errorf("%s: 第%d个请求的认证方式为 %q, 期望 %q", tt.name, i+1, scheme, tt.wantAuths[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseDataArg 按curl的语义处理 -d 系列选项的参数，返回要发送的数据片段
+func parseDataArg(opt, value string) (string, error) {
+	switch opt {
+	case "--data-raw":
+		// --data-raw 不解释 @ 前缀
+		return value, nil
+	case "--data-binary":
+		if strings.HasPrefix(value, "@") {
+			content, err := readDataFile(value[1:])
+			if err != nil {
+				return "", err
+			}
+			return string(content), nil
+		}
+		return value, nil
+	case "--data-urlencode":
+		return encodeDataArg(value)
+	default:
+		// -d/--data/--data-ascii 读取文件时与curl一样去掉回车和换行
+		if strings.HasPrefix(value, "@") {
+			content, err := readDataFile(value[1:])
+			if err != nil {
+				return "", err
+			}
+			return strings.NewReplacer("\r", "", "\n", "").Replace(string(content)), nil
+		}
+		return value, nil
+	}
+}
+
+// encodeDataArg 处理 --data-urlencode 的各种形式：
+//
+//	content       对content编码
+//	=content      对content编码，不带等号
+//	name=content  对content编码后拼接为 name=编码结果
+//	@file         对文件内容编码
+//	name@file     对文件内容编码后拼接为 name=编码结果
+func encodeDataArg(value string) (string, error) {
+	eqIdx := strings.Index(value, "=")
+	atIdx := strings.Index(value, "@")
+
+	switch {
+	case eqIdx != -1 && (atIdx == -1 || eqIdx < atIdx):
+		name := value[:eqIdx]
+		encoded := curlEscape(value[eqIdx+1:])
+		if name == "" {
+			return encoded, nil
+		}
+		return name + "=" + encoded, nil
+	case atIdx != -1:
+		content, err := readDataFile(value[atIdx+1:])
+		if err != nil {
+			return "", err
+		}
+		encoded := curlEscape(string(content))
+		if name := value[:atIdx]; name != "" {
+			return name + "=" + encoded, nil
+		}
+		return encoded, nil
+	default:
+		return curlEscape(value), nil
+	}
+}
+
+// readDataFile 读取数据文件，curl中的 @- 表示标准输入，agent不支持
+func readDataFile(name string) ([]byte, error) {
+	if name == "-" {
+		return nil, fmt.Errorf("不支持从标准输入读取数据")
+	}
+	return readTaskFile(name)
+}
+
+// curlEscape 与curl_easy_escape一致，除字母数字和 -._~ 之外的字节都编码为 %XX
+func curlEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0x0f])
+	}
+	return sb.String()
+}
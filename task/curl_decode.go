@@ -0,0 +1,177 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html/charset"
+)
+
+// --compressed 时发送的Accept-Encoding，与curl一致
+const curlAcceptEncoding = "deflate, gzip, br"
+
+// 在HTML/XML内容开头查找声明的字符集
+var (
+	metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-zA-Z0-9_\-:.]+)`)
+	xmlEncodingPattern = regexp.MustCompile(`(?i)^\s*<\?xml[^>]+encoding\s*=\s*["']([a-zA-Z0-9_\-:.]+)["']`)
+)
+
+// errBodyTooLarge 响应体或解压后的内容超过 curl.max_body_mb
+var errBodyTooLarge = errors.New("响应过大")
+
+// readBody 读取响应体，超过配置的大小上限时返回errBodyTooLarge，
+// 防止过大的响应或压缩炸弹耗尽agent的内存
+func readBody(r io.Reader) ([]byte, error) {
+	limit := curlOptions.MaxBodySize
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: 超过%d字节的上限", errBodyTooLarge, limit)
+	}
+	return data, nil
+}
+
+// 查找字符集声明时最多检查的字节数
+const charsetSniffLen = 4096
+
+// acceptedEncodings 返回本次请求声明可以接受的内容编码
+func (r *curlRequest) acceptedEncodings() map[string]bool {
+	accepted := make(map[string]bool)
+	header := r.headerValue("Accept-Encoding")
+	if header == "" && r.compressed {
+		header = curlAcceptEncoding
+	}
+	for _, item := range strings.Split(header, ",") {
+		name, _, _ := strings.Cut(item, ";")
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			accepted[name] = true
+		}
+	}
+	return accepted
+}
+
+// decompressBody 按Content-Encoding解压响应体，只处理请求中声明过可以接受的编码，
+// 其余情况与curl一样原样返回
+func (r *curlRequest) decompressBody(resp *http.Response, body []byte) ([]byte, error) {
+	encodingHeader := resp.Header.Get("Content-Encoding")
+	if encodingHeader == "" || len(body) == 0 {
+		return body, nil
+	}
+
+	accepted := r.acceptedEncodings()
+	encodings := strings.Split(encodingHeader, ",")
+
+	// 多重编码按相反顺序解码
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "identity" || encoding == "" {
+			continue
+		}
+		if !accepted[encoding] {
+			return body, nil
+		}
+
+		var reader io.Reader
+		switch encoding {
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("解压gzip响应失败: %v", err)
+			}
+			reader = gz
+		case "deflate":
+			// 标准的deflate带zlib头，部分服务器直接发送原始deflate数据
+			if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+				reader = zr
+			} else {
+				reader = flate.NewReader(bytes.NewReader(body))
+			}
+		case "br":
+			reader = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return body, nil
+		}
+
+		decoded, err := readBody(reader)
+		if errors.Is(err, errBodyTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解压%s响应失败: %v", encoding, err)
+		}
+		body = decoded
+	}
+
+	resp.Header.Del("Content-Length")
+	return body, nil
+}
+
+// detectCharset 按Content-Type的charset参数、HTML meta标签或XML声明确定响应字符集
+func detectCharset(contentType string, body []byte) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if label := params["charset"]; label != "" {
+			return strings.ToLower(label)
+		}
+	}
+
+	sniff := body
+	if len(sniff) > charsetSniffLen {
+		sniff = sniff[:charsetSniffLen]
+	}
+	if m := xmlEncodingPattern.FindSubmatch(sniff); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	if m := metaCharsetPattern.FindSubmatch(sniff); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	return ""
+}
+
+// convertToUTF8 将响应体转换为UTF-8，返回转换后的内容和原始字符集名称
+func convertToUTF8(contentType string, body []byte) ([]byte, string) {
+	label := detectCharset(contentType, body)
+	if label == "" {
+		return body, ""
+	}
+
+	enc, name := charset.Lookup(label)
+	if enc == nil || name == "utf-8" {
+		return body, label
+	}
+
+	// 纯ASCII内容在这些字符集下与UTF-8相同，无需转换
+	if !containsNonASCII(body) {
+		return body, label
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, label
+	}
+	return decoded, label
+}
+
+func containsNonASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// resolveEntry --resolve host:port:addr[,addr]... 指定的地址映射
+type resolveEntry struct {
+	host  string // 为 * 时匹配任意主机
+	port  string
+	addrs []string
+}
+
+// connectToRule --connect-to HOST1:PORT1:HOST2:PORT2 指定的连接目标改写，
+// HOST1/PORT1 为空时匹配任意值，HOST2/PORT2 为空时保持不变
+type connectToRule struct {
+	fromHost, fromPort string
+	toHost, toPort     string
+}
+
+// curlDialer 按 --resolve、--connect-to、--interface、-4/-6 建立连接。
+// 只改变实际连接的地址，请求URL不变，因此Host头和TLS的SNI仍使用原始主机名
+type curlDialer struct {
+	base      *net.Dialer
+	resolves  []resolveEntry
+	connectTo []connectToRule
+	family    string // "4"、"6"，为空时不限制
+}
+
+// parseResolve 解析 --resolve 的值，地址可以用逗号分隔多个，IPv6地址可以带方括号
+func parseResolve(value string) (resolveEntry, error) {
+	invalid := fmt.Errorf("选项 --resolve 的值无效: %s", value)
+
+	// 与curl一样，开头的 + 表示条目会过期，这里没有DNS缓存，直接忽略
+	parts := strings.SplitN(strings.TrimPrefix(value, "+"), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || !validPort(parts[1]) {
+		return resolveEntry{}, invalid
+	}
+
+	entry := resolveEntry{host: strings.ToLower(parts[0]), port: parts[1]}
+	for _, addr := range strings.Split(parts[2], ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "["), "]")
+		if net.ParseIP(addr) == nil {
+			return resolveEntry{}, invalid
+		}
+		entry.addrs = append(entry.addrs, addr)
+	}
+	return entry, nil
+}
+
+// parseConnectTo 解析 --connect-to 的值，主机可以是带方括号的IPv6地址
+func parseConnectTo(value string) (connectToRule, error) {
+	invalid := fmt.Errorf("选项 --connect-to 的值无效: %s", value)
+
+	var fields []string
+	rest := value
+	for i := 0; i < 4; i++ {
+		var field string
+		if i%2 == 0 && strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return connectToRule{}, invalid
+			}
+			field, rest = rest[1:end], rest[end+1:]
+		} else if colon := strings.Index(rest, ":"); colon != -1 && i < 3 {
+			field, rest = rest[:colon], rest[colon:]
+		} else {
+			field, rest = rest, ""
+		}
+		fields = append(fields, field)
+
+		if i < 3 {
+			if !strings.HasPrefix(rest, ":") {
+				return connectToRule{}, invalid
+			}
+			rest = rest[1:]
+		}
+	}
+	if rest != "" {
+		return connectToRule{}, invalid
+	}
+
+	for _, port := range []string{fields[1], fields[3]} {
+		if port != "" && !validPort(port) {
+			return connectToRule{}, invalid
+		}
+	}
+	return connectToRule{
+		fromHost: strings.ToLower(fields[0]), fromPort: fields[1],
+		toHost: fields[2], toPort: fields[3],
+	}, nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// newDialer 根据连接相关的选项创建拨号器
+func (r *curlRequest) newDialer(base *net.Dialer) (*curlDialer, error) {
+	d := &curlDialer{
+		base:      base,
+		resolves:  r.resolves,
+		connectTo: r.connectTo,
+		family:    r.ipVersion,
+	}
+
+	if r.iface != "" {
+		ip, err := interfaceAddr(r.iface, d.family)
+		if err != nil {
+			return nil, err
+		}
+		base.LocalAddr = &net.TCPAddr{IP: ip}
+		// 源地址决定了只能连接同一协议族的地址
+		if ip.To4() != nil {
+			d.family = "4"
+		} else {
+			d.family = "6"
+		}
+	}
+	return d, nil
+}
+
+// interfaceAddr 解析 --interface 的值：IP地址、网卡名或主机名，
+// 也支持curl的 if!网卡名 和 host!地址 写法
+func interfaceAddr(value, family string) (net.IP, error) {
+	name := value
+	byInterface, byHost := true, true
+	if strings.HasPrefix(value, "if!") {
+		name, byHost = value[3:], false
+	} else if strings.HasPrefix(value, "host!") {
+		name, byInterface = value[5:], false
+	}
+
+	if ip := net.ParseIP(name); ip != nil && byHost {
+		if !familyMatch(ip, family) {
+			return nil, fmt.Errorf("--interface 地址 %s 与 -%s 不匹配", name, family)
+		}
+		return ip, nil
+	}
+
+	var candidates []net.IP
+	if iface, err := net.InterfaceByName(name); err == nil && byInterface {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("获取网卡 %s 的地址失败: %v", name, err)
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				candidates = append(candidates, ipNet.IP)
+			}
+		}
+	} else if byHost {
+		ips, err := net.LookupIP(name)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网卡或地址: %s", name)
+		}
+		candidates = ips
+	} else {
+		return nil, fmt.Errorf("网卡不存在: %s", name)
+	}
+
+	// 未指定 -4/-6 时优先使用IPv4地址，与curl一致
+	if family == "" {
+		for _, ip := range candidates {
+			if ip.To4() != nil {
+				return ip, nil
+			}
+		}
+	}
+	for _, ip := range candidates {
+		if familyMatch(ip, family) && !ip.IsLinkLocalUnicast() {
+			return ip, nil
+		}
+	}
+	if family == "" {
+		return nil, fmt.Errorf("%s 没有可用的地址", name)
+	}
+	return nil, fmt.Errorf("%s 没有可用的IPv%s地址", name, family)
+}
+
+// familyMatch 判断IP是否属于 -4/-6 指定的协议族
+func familyMatch(ip net.IP, family string) bool {
+	switch family {
+	case "4":
+		return ip.To4() != nil
+	case "6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// network 按 -4/-6 限定网络类型
+func (d *curlDialer) network(network string) string {
+	if d.family != "" && network == "tcp" {
+		return network + d.family
+	}
+	return network
+}
+
+// connectTarget 按 --connect-to 改写连接目标，使用第一条匹配的规则
+func (d *curlDialer) connectTarget(host, port string) (string, string) {
+	for _, rule := range d.connectTo {
+		if rule.fromHost != "" && !strings.EqualFold(rule.fromHost, host) {
+			continue
+		}
+		if rule.fromPort != "" && rule.fromPort != port {
+			continue
+		}
+		if rule.toHost != "" {
+			host = rule.toHost
+		}
+		if rule.toPort != "" {
+			port = rule.toPort
+		}
+		break
+	}
+	return host, port
+}
+
+// resolvedAddrs 返回 --resolve 为主机指定的地址，后指定的条目优先
+func (d *curlDialer) resolvedAddrs(host, port string) []string {
+	for i := len(d.resolves) - 1; i >= 0; i-- {
+		entry := d.resolves[i]
+		if entry.port == port && (entry.host == "*" || strings.EqualFold(entry.host, host)) {
+			return entry.addrs
+		}
+	}
+	return nil
+}
+
+// target 返回实际要连接的地址列表
+func (d *curlDialer) target(addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	host, port = d.connectTarget(host, port)
+
+	addrs := d.resolvedAddrs(host, port)
+	if addrs == nil {
+		return []string{net.JoinHostPort(host, port)}, nil
+	}
+
+	var targets []string
+	for _, ip := range addrs {
+		if familyMatch(net.ParseIP(ip), d.family) {
+			targets = append(targets, net.JoinHostPort(ip, port))
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("--resolve 没有为 %s 指定IPv%s地址", host, d.family)
+	}
+	return targets, nil
+}
+
+// DialContext 依次尝试连接目标地址，返回第一个成功的连接
+func (d *curlDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	targets, err := d.target(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, target := range targets {
+		conn, err := d.base.DialContext(ctx, d.network(network), target)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// Dial 实现 proxy.Dialer，供SOCKS代理连接代理服务器使用
+func (d *curlDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
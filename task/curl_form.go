@@ -0,0 +1,283 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// formField -F/--form 指定的一个表单字段
+type formField struct {
+	name        string
+	value       string   // 文本字段的值
+	file        string   // @file 上传的文件名
+	contentFile string   // <file 从文件读取字段值
+	contentType string   // ;type= 指定的类型
+	filename    string   // ;filename= 指定的上传文件名
+	headers     []string // ;headers= 指定的额外头
+}
+
+// curl按扩展名推断上传文件类型时使用的对照表
+var curlMimeTypes = map[string]string{
+	".gif":  "image/gif",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".txt":  "text/plain",
+	".htm":  "text/html",
+	".html": "text/html",
+	".pdf":  "application/pdf",
+	".xml":  "application/xml",
+}
+
+// parseFormField 解析 -F 的参数，支持以下形式：
+//
+//	name=value
+//	name=@file;type=text/plain;filename=a.txt
+//	name=<file
+//	name="quoted;value";type=text/plain
+//
+// literal为true时（--form-string）整个值按原样作为文本字段
+func parseFormField(spec string, literal bool) (formField, error) {
+	eqIdx := strings.Index(spec, "=")
+	if eqIdx <= 0 {
+		return formField{}, fmt.Errorf("无效的表单字段: %s", spec)
+	}
+
+	field := formField{name: spec[:eqIdx]}
+	rest := spec[eqIdx+1:]
+
+	if literal {
+		field.value = rest
+		return field, nil
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "@"):
+		value, params, err := splitFormParams(rest[1:], false)
+		if err != nil {
+			return formField{}, err
+		}
+		field.file = value
+		field.filename = path.Base(filepath.ToSlash(value))
+		applyFormParams(&field, params)
+	case strings.HasPrefix(rest, "<"):
+		value, params, err := splitFormParams(rest[1:], false)
+		if err != nil {
+			return formField{}, err
+		}
+		field.contentFile = value
+		applyFormParams(&field, params)
+	default:
+		value, params, err := splitFormParams(rest, true)
+		if err != nil {
+			return formField{}, err
+		}
+		field.value = value
+		applyFormParams(&field, params)
+	}
+
+	return field, nil
+}
+
+// splitFormParams 将字段值与后续的 ;key=value 参数分开。
+// text为true时，只有后面跟着已知参数名的分号才被视为分隔符，其余分号属于字段值
+func splitFormParams(s string, text bool) (string, [][2]string, error) {
+	var value string
+
+	if strings.HasPrefix(s, "\"") {
+		unquoted, rest, err := readFormQuoted(s)
+		if err != nil {
+			return "", nil, err
+		}
+		value, s = unquoted, rest
+	} else {
+		end := len(s)
+		for i := 0; i < len(s); i++ {
+			if s[i] != ';' {
+				continue
+			}
+			if !text || isFormParam(s[i+1:]) {
+				end = i
+				break
+			}
+		}
+		value, s = s[:end], s[end:]
+	}
+
+	var params [][2]string
+	for s != "" {
+		if s[0] != ';' {
+			return "", nil, fmt.Errorf("无效的表单字段参数: %s", s)
+		}
+		s = strings.TrimLeft(s[1:], " ")
+		if s == "" {
+			break
+		}
+
+		eqIdx := strings.Index(s, "=")
+		if eqIdx <= 0 {
+			return "", nil, fmt.Errorf("无效的表单字段参数: %s", s)
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eqIdx]))
+		s = s[eqIdx+1:]
+
+		var paramValue string
+		if strings.HasPrefix(s, "\"") {
+			unquoted, rest, err := readFormQuoted(s)
+			if err != nil {
+				return "", nil, err
+			}
+			paramValue, s = unquoted, rest
+		} else if semi := strings.Index(s, ";"); semi != -1 {
+			paramValue, s = s[:semi], s[semi:]
+		} else {
+			paramValue, s = s, ""
+		}
+		params = append(params, [2]string{key, paramValue})
+	}
+
+	return value, params, nil
+}
+
+// isFormParam 判断字符串是否以curl支持的表单参数名开头
+func isFormParam(s string) bool {
+	s = strings.ToLower(strings.TrimLeft(s, " "))
+	for _, key := range []string{"type=", "filename=", "headers=", "encoder="} {
+		if strings.HasPrefix(s, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// readFormQuoted 读取双引号包围的值，支持反斜杠转义，返回去掉引号的值和剩余部分
+func readFormQuoted(s string) (string, string, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		case '"':
+			return sb.String(), s[i+1:], nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("表单字段引号未闭合: %s", s)
+}
+
+// applyFormParams 将解析出的参数应用到表单字段
+func applyFormParams(field *formField, params [][2]string) {
+	for _, p := range params {
+		switch p[0] {
+		case "type":
+			field.contentType = p[1]
+		case "filename":
+			field.filename = p[1]
+		case "headers":
+			field.headers = append(field.headers, p[1])
+		}
+		// encoder 等其它参数不影响请求内容，忽略
+	}
+}
+
+// newCurlBoundary 生成与curl格式一致的分隔符：24个短横线加22个随机字母数字
+func newCurlBoundary() (string, error) {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	buf := make([]byte, 22)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = alphabet[int(b)%len(alphabet)]
+	}
+	return strings.Repeat("-", 24) + string(buf), nil
+}
+
+// escapeFormName 按curl默认的HTML5规则转义字段名和文件名中的引号与换行
+func escapeFormName(s string) string {
+	return strings.NewReplacer("\"", "%22", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// buildMultipartBody 构造multipart/form-data请求体，返回请求体和带boundary的Content-Type
+func buildMultipartBody(fields []formField) ([]byte, string, error) {
+	boundary, err := newCurlBoundary()
+	if err != nil {
+		return nil, "", fmt.Errorf("生成multipart分隔符失败: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, "", fmt.Errorf("设置multipart分隔符失败: %v", err)
+	}
+
+	for _, field := range fields {
+		content := []byte(field.value)
+		contentType := field.contentType
+		disposition := fmt.Sprintf(`form-data; name="%s"`, escapeFormName(field.name))
+
+		switch {
+		case field.file != "":
+			content, err = readTaskFile(field.file)
+			if err != nil {
+				return nil, "", err
+			}
+			disposition += fmt.Sprintf(`; filename="%s"`, escapeFormName(field.filename))
+			if contentType == "" {
+				contentType = curlMimeTypes[strings.ToLower(filepath.Ext(field.file))]
+			}
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+		case field.contentFile != "":
+			content, err = readTaskFile(field.contentFile)
+			if err != nil {
+				return nil, "", err
+			}
+			if field.filename != "" {
+				disposition += fmt.Sprintf(`; filename="%s"`, escapeFormName(field.filename))
+			}
+		default:
+			if field.filename != "" {
+				disposition += fmt.Sprintf(`; filename="%s"`, escapeFormName(field.filename))
+			}
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", disposition)
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		for _, line := range field.headers {
+			if colonIdx := strings.Index(line, ":"); colonIdx != -1 {
+				header.Add(strings.TrimSpace(line[:colonIdx]), strings.TrimSpace(line[colonIdx+1:]))
+			}
+		}
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", fmt.Errorf("创建表单字段失败: %v", err)
+		}
+		if _, err := part.Write(content); err != nil {
+			return nil, "", fmt.Errorf("写入表单字段失败: %v", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("构造multipart请求体失败: %v", err)
+	}
+
+	return buf.Bytes(), "multipart/form-data; boundary=" + boundary, nil
+}
@@ -0,0 +1,307 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 与curl一致的默认请求头
+const (
+	curlUserAgent = "curl/8.5.0"
+	curlAccept    = "*/*"
+)
+
+// 请求头块的最大长度，超过后不再调整顺序直接发送
+const maxHeaderBlock = 1 << 20
+
+// headerField -H 指定的一个请求头，保留原始的名称大小写
+type headerField struct {
+	name  string
+	value string
+}
+
+// addHeader 按curl的规则处理 -H 的值：
+//
+//	Name: value  添加请求头，同名的头可以出现多次
+//	Name:        不发送该请求头，包括默认的User-Agent、Accept、Host等
+//	Name;        发送值为空的请求头
+//	@file        从文件中逐行读取请求头
+func (r *curlRequest) addHeader(value string) error {
+	if strings.HasPrefix(value, "@") {
+		content, err := readDataFile(value[1:])
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+				r.addHeaderLine(line)
+			}
+		}
+		return nil
+	}
+	r.addHeaderLine(value)
+	return nil
+}
+
+func (r *curlRequest) addHeaderLine(line string) {
+	if colonIdx := strings.Index(line, ":"); colonIdx != -1 {
+		name := strings.TrimSpace(line[:colonIdx])
+		value := strings.TrimSpace(line[colonIdx+1:])
+		if name == "" {
+			return
+		}
+		if value == "" {
+			r.removedHeaders = append(r.removedHeaders, name)
+			return
+		}
+		r.headers = append(r.headers, headerField{name: name, value: value})
+		return
+	}
+
+	if trimmed := strings.TrimSpace(line); strings.HasSuffix(trimmed, ";") {
+		if name := strings.TrimSpace(strings.TrimSuffix(trimmed, ";")); name != "" && !strings.ContainsAny(name, " ;") {
+			r.headers = append(r.headers, headerField{name: name})
+		}
+	}
+}
+
+// setReferer 处理 -e/--referer，";auto" 表示跟随重定向时自动设置Referer
+func (r *curlRequest) setReferer(value string) {
+	if strings.HasSuffix(value, ";auto") {
+		value = strings.TrimSuffix(value, ";auto")
+		r.autoReferer = true
+	}
+	r.referer = value
+}
+
+// hasHeader 判断 -H 是否指定（或移除）了某个请求头，此时不再使用对应的默认值
+func (r *curlRequest) hasHeader(name string) bool {
+	for _, h := range r.headers {
+		if strings.EqualFold(h.name, name) {
+			return true
+		}
+	}
+	return r.headerRemoved(name)
+}
+
+// headerValue 不区分大小写地查找 -H 指定的请求头，多次指定时返回最后一个
+func (r *curlRequest) headerValue(name string) string {
+	value := ""
+	for _, h := range r.headers {
+		if strings.EqualFold(h.name, name) {
+			value = h.value
+		}
+	}
+	return value
+}
+
+// headerRemoved 判断请求头是否通过 -H "Name:" 移除
+func (r *curlRequest) headerRemoved(name string) bool {
+	for _, removed := range r.removedHeaders {
+		if strings.EqualFold(removed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHeaders 按 -H 的顺序设置请求头，并补充 -A、-e 和curl的默认请求头
+func (r *curlRequest) applyHeaders(req *http.Request) {
+	for _, h := range r.headers {
+		// Go使用req.Host作为Host头，Header中的Host会被忽略
+		if strings.EqualFold(h.name, "Host") {
+			req.Host = h.value
+			continue
+		}
+		req.Header.Add(h.name, h.value)
+	}
+
+	userAgent := curlUserAgent
+	if r.userAgent != "" {
+		userAgent = r.userAgent
+	}
+	if !r.hasHeader("User-Agent") {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if !r.hasHeader("Accept") {
+		req.Header.Set("Accept", curlAccept)
+	}
+	if r.referer != "" && !r.hasHeader("Referer") {
+		req.Header.Set("Referer", r.referer)
+	}
+}
+
+// removeHeaders 删除 -H "Name:" 移除的请求头。User-Agent设置为空值，
+// 避免Go补上默认的 Go-http-client；Host等由Go生成的头在发送时由orderedConn去掉
+func (r *curlRequest) removeHeaders(req *http.Request) {
+	for _, name := range r.removedHeaders {
+		if strings.EqualFold(name, "User-Agent") {
+			req.Header["User-Agent"] = []string{""}
+			continue
+		}
+		req.Header.Del(name)
+	}
+}
+
+// headerOrder 返回请求头的发送顺序，与curl一致：Host、认证、User-Agent、Accept等默认头在前，
+// 然后按 -H 的顺序发送自定义头，最后是请求体的Content-Length和Content-Type
+func (r *curlRequest) headerOrder() []string {
+	order := []string{"Host"}
+	for _, name := range []string{"Authorization", "User-Agent", "Accept", "Accept-Encoding", "Referer", "Cookie"} {
+		if !r.hasHeader(name) {
+			order = append(order, name)
+		}
+	}
+	for _, h := range r.headers {
+		if !strings.EqualFold(h.name, "Host") {
+			order = append(order, h.name)
+		}
+	}
+	for _, name := range []string{"Content-Length", "Content-Type"} {
+		if !r.hasHeader(name) {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// orderedConn 在发送前调整Go生成的请求头：按 headerOrder 排序、恢复 -H 中名称的大小写、
+// 保留重复的同名头并去掉被移除的头。Go会按字母顺序发送请求头，部分WAF会据此识别客户端
+type orderedConn struct {
+	net.Conn
+	order   []string
+	removed []string
+	buf     []byte
+	body    int64 // 当前请求还未发送的请求体字节数
+	raw     bool  // CONNECT隧道或无法确定请求体长度时不再改写
+}
+
+// orderHeaders 包装连接，使请求头按curl的顺序发送
+func (r *curlRequest) orderHeaders(conn net.Conn) net.Conn {
+	return &orderedConn{Conn: conn, order: r.headerOrder(), removed: r.removedHeaders}
+}
+
+func (c *orderedConn) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if c.raw {
+			if _, err := c.Conn.Write(p); err != nil {
+				return 0, err
+			}
+			return n, nil
+		}
+
+		// 转发请求体
+		if c.body > 0 {
+			chunk := p
+			if int64(len(chunk)) > c.body {
+				chunk = chunk[:c.body]
+			}
+			if _, err := c.Conn.Write(chunk); err != nil {
+				return 0, err
+			}
+			c.body -= int64(len(chunk))
+			p = p[len(chunk):]
+			continue
+		}
+
+		// 缓存请求头直到遇到空行
+		c.buf = append(c.buf, p...)
+		p = nil
+		end := bytes.Index(c.buf, []byte("\r\n\r\n"))
+		if end == -1 {
+			if len(c.buf) > maxHeaderBlock {
+				c.raw = true
+				p, c.buf = c.buf, nil
+			}
+			continue
+		}
+
+		block, rest := c.buf[:end+4], c.buf[end+4:]
+		c.buf = nil
+		if _, err := c.Conn.Write(c.rewrite(block)); err != nil {
+			return 0, err
+		}
+		p = rest
+	}
+	return n, nil
+}
+
+// rewrite 调整一个请求头块，并根据Content-Length确定随后的请求体长度
+func (c *orderedConn) rewrite(block []byte) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(block), "\r\n\r\n"), "\r\n")
+	requestLine := lines[0]
+
+	type field struct {
+		name, value string
+		used        bool
+	}
+	var fields []*field
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		fields = append(fields, &field{name: name, value: strings.TrimSpace(value)})
+	}
+
+	removed := func(name string) bool {
+		// 请求体的长度不能去掉，否则服务器无法确定请求边界
+		if strings.EqualFold(name, "Content-Length") || strings.EqualFold(name, "Transfer-Encoding") {
+			return false
+		}
+		for _, r := range c.removed {
+			if strings.EqualFold(r, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var sb strings.Builder
+	sb.WriteString(requestLine)
+	sb.WriteString("\r\n")
+	write := func(name, value string) {
+		sb.WriteString(name)
+		sb.WriteString(":")
+		if value != "" {
+			sb.WriteString(" ")
+			sb.WriteString(value)
+		}
+		sb.WriteString("\r\n")
+	}
+
+	// 先按计划的顺序输出，同名的头按出现顺序依次对应
+	for _, name := range c.order {
+		for _, f := range fields {
+			if !f.used && strings.EqualFold(f.name, name) {
+				f.used = true
+				if !removed(name) {
+					write(name, f.value)
+				}
+				break
+			}
+		}
+	}
+	// 其余的头保持Go的顺序
+	for _, f := range fields {
+		if !f.used && !removed(f.name) {
+			write(f.name, f.value)
+		}
+	}
+	sb.WriteString("\r\n")
+
+	// CONNECT之后是TLS隧道数据；分块编码无法确定请求体边界，之后的数据都原样发送
+	c.raw = strings.HasPrefix(requestLine, "CONNECT ")
+	for _, f := range fields {
+		switch {
+		case strings.EqualFold(f.name, "Content-Length"):
+			c.body, _ = strconv.ParseInt(f.value, 10, 64)
+		case strings.EqualFold(f.name, "Transfer-Encoding"):
+			c.raw = true
+		}
+	}
+
+	return []byte(sb.String())
+}
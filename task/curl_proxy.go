@@ -0,0 +1,342 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxySettings 一次请求最终使用的代理设置
+type proxySettings struct {
+	proxyURL *url.URL // 为nil时直连
+	fromEnv  bool     // 任务和配置都未指定代理时，与curl一样使用环境变量中的代理
+	noProxy  []string // 不经过代理的主机列表
+	// tlsConfig 连接HTTPS代理的TLS配置，只由 --proxy-cacert、--proxy-insecure 决定，
+	// 与请求目标的证书、固定公钥等选项无关
+	tlsConfig *tls.Config
+}
+
+// resolveProxy 合并任务中的 -x/--proxy-user/--noproxy 与配置中的默认代理。
+// 任务未指定 -x 时继承默认代理；-x "" 表示直连
+func (r *curlRequest) resolveProxy() (*proxySettings, error) {
+	proxyStr := curlOptions.Proxy
+	if r.proxySet {
+		proxyStr = r.proxy
+	}
+
+	noProxy := curlOptions.NoProxy
+	if r.noProxySet {
+		noProxy = r.noProxy
+	}
+
+	tlsConfig, err := r.proxyTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &proxySettings{noProxy: splitNoProxy(noProxy), tlsConfig: tlsConfig}
+	if proxyStr == "" {
+		settings.fromEnv = !r.proxySet
+		return settings, nil
+	}
+
+	proxyURL, err := parseProxyURL(proxyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.proxyUser != "" {
+		if user, pass, ok := strings.Cut(r.proxyUser, ":"); ok {
+			proxyURL.User = url.UserPassword(user, pass)
+		} else {
+			proxyURL.User = url.User(user)
+		}
+	}
+
+	settings.proxyURL = proxyURL
+	return settings, nil
+}
+
+// proxyTLSConfig 构造连接HTTPS代理的TLS配置：默认使用系统证书校验代理，
+// --proxy-cacert 指定代理的CA证书，--proxy-insecure 不校验代理的证书
+func (r *curlRequest) proxyTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: r.proxyInsecure}
+	if r.proxyCACert != "" {
+		data, err := readCertFile(r.proxyCACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA证书文件中没有有效的证书: %s", r.proxyCACert)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// parseProxyURL 解析代理地址，与curl一样未指定协议时使用http，未指定端口时使用1080
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的代理地址: %s", redactURL(s))
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+	}
+
+	if u.Port() == "" {
+		port := "1080"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return u, nil
+}
+
+// splitNoProxy 拆分逗号分隔的 --noproxy 列表
+func splitNoProxy(s string) []string {
+	var hosts []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// bypass 按curl的 --noproxy 规则判断主机是否直连：
+// "*" 匹配所有主机，域名同时匹配其子域名，也支持IP和CIDR
+func (p *proxySettings) bypass(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	ip := net.ParseIP(host)
+
+	for _, pattern := range p.noProxy {
+		if pattern == "*" {
+			return true
+		}
+		if ip != nil {
+			if _, cidr, err := net.ParseCIDR(pattern); err == nil && cidr.Contains(ip) {
+				return true
+			}
+			if patternIP := net.ParseIP(pattern); patternIP != nil && patternIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "."), ".")
+		if host == pattern || strings.HasSuffix(host, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// forURL 返回访问u时使用的代理，直连时返回nil
+func (p *proxySettings) forURL(u *url.URL) (*url.URL, error) {
+	if p.bypass(u.Hostname()) {
+		return nil, nil
+	}
+	if p.proxyURL != nil {
+		return p.proxyURL, nil
+	}
+	if p.fromEnv {
+		return http.ProxyFromEnvironment(&http.Request{URL: u})
+	}
+	return nil, nil
+}
+
+// apply 将代理设置应用到transport。HTTP请求经HTTP代理时由Transport.Proxy以绝对URL转发，
+// 其余情况都由dialTarget拨号：SOCKS代理在拨号时完成握手，经HTTPS代理的请求和经HTTP代理的HTTPS请求
+// 自行发送CONNECT，在隧道上完成TLS握手后请求头的顺序才能在TLS之上调整
+func (p *proxySettings) apply(transport *http.Transport, dialer *curlDialer) {
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if req.URL.Scheme != "http" {
+			return nil, nil
+		}
+		proxyURL, err := p.forURL(req.URL)
+		if err != nil || proxyURL == nil || proxyURL.Scheme != "http" {
+			return nil, err
+		}
+		return proxyURL, nil
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return p.dialTarget(ctx, dialer, "http", network, addr, transport.TLSHandshakeTimeout)
+	}
+}
+
+// dialTarget 按代理设置连接scheme请求的目标addr。HTTP请求经HTTP代理时addr是代理本身，直接连接；
+// HTTPS请求经HTTP代理或任何请求经HTTPS代理时通过CONNECT建立隧道，timeout用于与HTTPS代理的TLS握手
+func (p *proxySettings) dialTarget(ctx context.Context, dialer *curlDialer, scheme, network, addr string, timeout time.Duration) (net.Conn, error) {
+	proxyURL, err := p.forURL(&url.URL{Scheme: scheme, Host: addr})
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case proxyURL == nil:
+		return dialer.DialContext(ctx, network, addr)
+	case proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h":
+		return dialSOCKS(ctx, dialer, proxyURL, network, addr)
+	case scheme == "https" || proxyURL.Scheme == "https":
+		return p.connectTunnel(ctx, dialer, proxyURL, addr, timeout)
+	default:
+		return proxyDialer{dialer}.DialContext(ctx, network, addr)
+	}
+}
+
+// proxyDialer 连接代理服务器本身，只应用 --interface 和 -4/-6。
+// --resolve 和 --connect-to 只改写请求的目标，不改写代理的地址
+type proxyDialer struct {
+	*curlDialer
+}
+
+func (d proxyDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.base.DialContext(ctx, d.network(network), addr)
+}
+
+// dialSOCKS 通过SOCKS代理连接addr：socks5 在本地解析域名，socks5h 由代理解析域名
+func dialSOCKS(ctx context.Context, dialer *curlDialer, proxyURL *url.URL, network, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+	}
+	socksDialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, proxyDialer{dialer})
+	if err != nil {
+		return nil, fmt.Errorf("创建SOCKS代理失败: %v", err)
+	}
+
+	// --connect-to 和 --resolve 改写交给代理连接的目标
+	targets, err := dialer.target(addr)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(targets[0])
+	if err != nil {
+		return nil, err
+	}
+	addr = targets[0]
+
+	if proxyURL.Scheme != "socks5h" && net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip"+dialer.family, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("无法解析主机: %s", host)
+		}
+		addr = net.JoinHostPort(ips[0].String(), port)
+	}
+	return socksDialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+}
+
+// connectTunnel 连接HTTP/HTTPS代理并发送CONNECT，返回到addr的隧道。
+// HTTPS代理使用单独的TLS配置，代理地址URL中的用户名密码作为Proxy-Authorization发送
+func (p *proxySettings) connectTunnel(ctx context.Context, dialer *curlDialer, proxyURL *url.URL, addr string, timeout time.Duration) (net.Conn, error) {
+	// 与SOCKS代理一样，--connect-to 和 --resolve 改写交给代理连接的目标
+	targets, err := dialer.target(addr)
+	if err != nil {
+		return nil, err
+	}
+	addr = targets[0]
+
+	conn, err := proxyDialer{dialer}.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = p.proxyHandshake(ctx, conn, proxyURL, timeout); err != nil {
+			return nil, fmt.Errorf("连接HTTPS代理失败: %v", err)
+		}
+	}
+
+	// ctx取消时关闭连接，中断等待代理响应
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("发送CONNECT请求失败: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("读取代理响应失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("代理拒绝建立隧道: %s", resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("代理在隧道建立前发送了多余的数据")
+	}
+	return conn, nil
+}
+
+// proxyHandshake 与HTTPS代理完成TLS握手，按代理的主机名校验证书。
+// 不计入请求的TLS耗时，trace中的TLS时间只对应与请求目标的握手
+func (p *proxySettings) proxyHandshake(ctx context.Context, conn net.Conn, proxyURL *url.URL, timeout time.Duration) (net.Conn, error) {
+	config := p.tlsConfig.Clone()
+	config.ServerName = proxyURL.Hostname()
+	tlsConn := tls.Client(conn, config)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// redactURL 隐藏URL中的密码，用于日志和错误信息
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
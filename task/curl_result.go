@@ -0,0 +1,299 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CurlResult curl任务的结构化执行结果
+type CurlResult struct {
+	StatusCode int                 `json:"status_code"`
+	Protocol   string              `json:"protocol"`
+	Headers    map[string][]string `json:"headers"`
+	URL        string              `json:"url"` // 跟随重定向后的最终URL
+	Body       string              `json:"body"`
+	// Charset 响应声明的原始字符集，body已转换为UTF-8
+	Charset string `json:"charset,omitempty"`
+	// Output 与curl标准输出一致的内容：-i/-I 时包含响应头，-w 的输出追加在最后
+	Output    string      `json:"output"`
+	Redirects int         `json:"redirects"`
+	Retries   int         `json:"retries"`
+	Timings   CurlTimings `json:"timings"`
+}
+
+// CurlTimings 请求各阶段耗时（毫秒）
+type CurlTimings struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"` // 从开始到收到第一个响应字节
+	Total   float64 `json:"total_ms"`
+}
+
+// curlTrace 记录一次请求尝试中各阶段的时间点，供计算耗时和 -w 变量使用
+type curlTrace struct {
+	start         time.Time
+	dnsStart      time.Time
+	dnsDone       time.Time
+	connectStart  time.Time
+	connectDone   time.Time
+	tlsStart      time.Time
+	tlsDone       time.Time
+	wroteRequest  time.Time
+	firstByte     time.Time
+	lastHopStart  time.Time // 最后一次重定向请求的开始时间
+	end           time.Time
+	remoteAddr    string
+	redirectChain []*http.Response // 跟随重定向时经过的中间响应
+}
+
+// clientTrace 返回记录时间点的httptrace钩子
+func (t *curlTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn:           func(string) { t.lastHopStart = time.Now() },
+		DNSStart:          func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.dnsDone = time.Now() },
+		ConnectStart:      func(string, string) { t.connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { t.connectDone = time.Now() },
+		TLSHandshakeStart: func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.tlsDone = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { t.firstByte = time.Now() },
+	}
+}
+
+// since 返回从开始到指定时间点的秒数，时间点未发生时返回0
+func (t *curlTrace) since(at time.Time) float64 {
+	if at.IsZero() {
+		return 0
+	}
+	return at.Sub(t.start).Seconds()
+}
+
+func phaseMillis(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return roundMillis(to.Sub(from))
+}
+
+func roundMillis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
+
+// newCurlResult 根据最终响应构造结构化结果
+// rawSize 为解压前的响应体大小，对应 -w %{size_download}
+func (r *curlRequest) newCurlResult(resp *http.Response, body []byte, rawSize int, retries int) *CurlResult {
+	trace := r.trace
+	result := &CurlResult{
+		StatusCode: resp.StatusCode,
+		Protocol:   resp.Proto,
+		Headers:    resp.Header,
+		URL:        resp.Request.URL.String(),
+		Body:       string(body),
+		Redirects:  len(trace.redirectChain),
+		Retries:    retries,
+		Timings: CurlTimings{
+			DNS:     phaseMillis(trace.dnsStart, trace.dnsDone),
+			Connect: phaseMillis(trace.connectStart, trace.connectDone),
+			TLS:     phaseMillis(trace.tlsStart, trace.tlsDone),
+			TTFB:    phaseMillis(trace.start, trace.firstByte),
+			Total:   phaseMillis(trace.start, trace.end),
+		},
+	}
+
+	// 组装与curl标准输出一致的内容
+	var sb strings.Builder
+	if r.includeHeaders || r.headOnly {
+		for _, hop := range trace.redirectChain {
+			sb.WriteString(formatResponseHeaders(hop))
+		}
+		sb.WriteString(formatResponseHeaders(resp))
+	}
+	if !r.headOnly && !r.outputToFile {
+		sb.WriteString(result.Body)
+	}
+	if r.writeOut != "" {
+		sb.WriteString(r.formatWriteOut(result, resp, rawSize))
+	}
+	result.Output = sb.String()
+
+	return result
+}
+
+// formatResponseHeaders 按curl -i 的格式输出状态行和响应头
+func formatResponseHeaders(resp *http.Response) string {
+	var sb strings.Builder
+	sb.WriteString(statusLine(resp))
+	sb.WriteString("\r\n")
+
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			fmt.Fprintf(&sb, "%s: %s\r\n", name, value)
+		}
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+// statusLine 与curl一致：HTTP/2 只输出状态码，HTTP/1.x 输出完整状态行
+func statusLine(resp *http.Response) string {
+	if resp.ProtoMajor >= 2 {
+		return fmt.Sprintf("HTTP/%d %d", resp.ProtoMajor, resp.StatusCode)
+	}
+	return fmt.Sprintf("%s %s", resp.Proto, resp.Status)
+}
+
+// httpVersion 返回 -w %{http_version} 的值
+func httpVersion(resp *http.Response) string {
+	if resp.ProtoMajor >= 2 {
+		return strconv.Itoa(resp.ProtoMajor)
+	}
+	return fmt.Sprintf("%d.%d", resp.ProtoMajor, resp.ProtoMinor)
+}
+
+// formatWriteOut 展开 -w 格式串中的 %{变量}、%header{名称} 和 \n 等转义
+func (r *curlRequest) formatWriteOut(result *CurlResult, resp *http.Response, bodySize int) string {
+	trace := r.trace
+	format := r.writeOut
+
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		if c == '\\' && i+1 < len(format) {
+			switch format[i+1] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '\\':
+				sb.WriteByte('\\')
+			default:
+				sb.WriteByte(c)
+				continue
+			}
+			i++
+			continue
+		}
+
+		if c != '%' || i+1 >= len(format) {
+			sb.WriteByte(c)
+			continue
+		}
+		if format[i+1] == '%' {
+			sb.WriteByte('%')
+			i++
+			continue
+		}
+
+		rest := format[i+1:]
+		if strings.HasPrefix(rest, "header{") {
+			if end := strings.Index(rest, "}"); end != -1 {
+				sb.WriteString(strings.Join(resp.Header.Values(rest[len("header{"):end]), ", "))
+				i += end + 1
+				continue
+			}
+		}
+		if strings.HasPrefix(rest, "{") {
+			if end := strings.Index(rest, "}"); end != -1 {
+				if value, ok := writeOutVariable(rest[1:end], result, resp, trace, bodySize); ok {
+					sb.WriteString(value)
+				}
+				i += end + 1
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// writeOutVariable 返回 -w 变量的值，时间以秒为单位并保留6位小数，与curl一致
+func writeOutVariable(name string, result *CurlResult, resp *http.Response, trace *curlTrace, bodySize int) (string, bool) {
+	seconds := func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) }
+
+	switch name {
+	case "http_code", "response_code":
+		return fmt.Sprintf("%03d", resp.StatusCode), true
+	case "http_version":
+		return httpVersion(resp), true
+	case "method":
+		return resp.Request.Method, true
+	case "scheme":
+		return strings.ToUpper(resp.Request.URL.Scheme), true
+	case "url", "url_effective":
+		return result.URL, true
+	case "redirect_url":
+		if location, err := resp.Location(); err == nil {
+			return location.String(), true
+		}
+		return "", true
+	case "content_type":
+		return resp.Header.Get("Content-Type"), true
+	case "num_redirects":
+		return strconv.Itoa(result.Redirects), true
+	case "num_retries":
+		return strconv.Itoa(result.Retries), true
+	case "num_headers":
+		return strconv.Itoa(len(resp.Header)), true
+	case "remote_ip", "remote_port":
+		host, port, err := net.SplitHostPort(trace.remoteAddr)
+		if err != nil {
+			return "", true
+		}
+		if name == "remote_ip" {
+			return host, true
+		}
+		return port, true
+	case "size_download":
+		return strconv.Itoa(bodySize), true
+	case "size_header":
+		return strconv.Itoa(len(formatResponseHeaders(resp))), true
+	case "speed_download":
+		total := trace.end.Sub(trace.start).Seconds()
+		if total <= 0 {
+			return "0", true
+		}
+		return strconv.FormatFloat(float64(bodySize)/total, 'f', 0, 64), true
+	case "time_namelookup":
+		return seconds(trace.since(trace.dnsDone)), true
+	case "time_connect":
+		return seconds(trace.since(trace.connectDone)), true
+	case "time_appconnect":
+		return seconds(trace.since(trace.tlsDone)), true
+	case "time_pretransfer":
+		return seconds(trace.since(trace.wroteRequest)), true
+	case "time_starttransfer":
+		return seconds(trace.since(trace.firstByte)), true
+	case "time_redirect":
+		if len(trace.redirectChain) == 0 {
+			return seconds(0), true
+		}
+		return seconds(trace.since(trace.lastHopStart)), true
+	case "time_total":
+		return seconds(trace.since(trace.end)), true
+	}
+	return "", false
+}
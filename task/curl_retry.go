@@ -0,0 +1,170 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// curl视为临时错误、会触发 --retry 重试的HTTP状态码
+var transientStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// 指数退避时的最长等待时间，与curl一致
+const maxRetryBackoff = 10 * time.Minute
+
+// doOnce 执行一次请求并读取完整响应
+func (r *curlRequest) doOnce(ctx context.Context, client *http.Client, body []byte, contentType string) (*http.Response, []byte, error) {
+	req, err := r.newRequest(body, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 记录各阶段耗时
+	r.trace = &curlTrace{start: time.Now()}
+	defer func() { r.trace.end = time.Now() }()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, r.trace.clientTrace()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Digest等认证需要根据401质询重新发送带认证信息的请求
+	if resp.StatusCode == http.StatusUnauthorized && r.needsChallenge() {
+		authReq, err := r.newRequest(body, contentType)
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, err
+		}
+		authReq = authReq.WithContext(req.Context())
+		if r.authenticate(resp, authReq, body) {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp, err = client.Do(authReq); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return resp, nil, err
+	}
+
+	return resp, respBody, nil
+}
+
+// doWithRetry 执行请求，并按 --retry、--retry-delay、--retry-max-time 等选项重试
+// 返回最终响应、响应体和重试次数。ctx取消后不再重试
+func (r *curlRequest) doWithRetry(ctx context.Context, client *http.Client, body []byte, contentType string) (*http.Response, []byte, int, error) {
+	start := time.Now()
+	retryMaxTime := r.retryMaxTime
+	if retryMaxTime > 0 {
+		retryMaxTime = capTimeout(retryMaxTime)
+	}
+	backoff := time.Second
+
+	for attempt := 0; ; attempt++ {
+		resp, respBody, err := r.doOnce(ctx, client, body, contentType)
+
+		if attempt >= r.retry || ctx.Err() != nil || !r.shouldRetry(resp, err) {
+			if err != nil {
+				return nil, nil, attempt, describeRequestError(err)
+			}
+			return resp, respBody, attempt, nil
+		}
+
+		// 计算下次重试前的等待时间：优先使用 Retry-After，其次是 --retry-delay，否则指数退避
+		delay := r.retryDelay
+		if delay == 0 {
+			delay = backoff
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+		if resp != nil {
+			if after := parseRetryAfter(resp.Header.Get("Retry-After")); after > 0 {
+				delay = after
+			}
+		}
+		delay = capTimeout(delay)
+
+		// 超过 --retry-max-time 后不再发起新的重试
+		if retryMaxTime > 0 && time.Since(start)+delay > retryMaxTime {
+			if err != nil {
+				return nil, nil, attempt, describeRequestError(err)
+			}
+			return resp, respBody, attempt, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if err != nil {
+				return nil, nil, attempt, describeRequestError(err)
+			}
+			return resp, respBody, attempt, nil
+		}
+	}
+}
+
+// shouldRetry 判断一次请求的结果是否需要重试
+func (r *curlRequest) shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		// 响应过大时重试也不会改变结果
+		if errors.Is(err, errBodyTooLarge) {
+			return false
+		}
+		if r.retryAllErrors || isTimeoutError(err) {
+			return true
+		}
+		return r.retryConnRefuse && errors.Is(err, syscall.ECONNREFUSED)
+	}
+	return resp != nil && transientStatusCodes[resp.StatusCode]
+}
+
+// parseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// isTimeoutError 判断错误是否为超时
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// describeRequestError 将请求错误转换为便于理解的错误信息
+func describeRequestError(err error) error {
+	if isTimeoutError(err) {
+		return fmt.Errorf("执行HTTP请求超时: %v", err)
+	}
+	return fmt.Errorf("执行HTTP请求失败: %v", err)
+}
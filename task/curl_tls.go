@@ -0,0 +1,331 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+)
+
+// tlsVersions --tlsv1.x 选项对应的TLS最低版本
+var tlsVersions = map[string]uint16{
+	"--tlsv1":   tls.VersionTLS10,
+	"--tlsv1.0": tls.VersionTLS10,
+	"--tlsv1.1": tls.VersionTLS11,
+	"--tlsv1.2": tls.VersionTLS12,
+	"--tlsv1.3": tls.VersionTLS13,
+}
+
+// opensslCipherNames curl(OpenSSL)使用的加密套件名与Go中套件名的对应关系
+var opensslCipherNames = map[string]string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-RSA-AES128-GCM-SHA256":   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384": "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-RSA-AES256-GCM-SHA384":   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-ECDSA-CHACHA20-POLY1305": "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	"ECDHE-RSA-CHACHA20-POLY1305":   "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	"ECDHE-ECDSA-AES128-SHA256":     "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	"ECDHE-RSA-AES128-SHA256":       "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	"ECDHE-ECDSA-AES128-SHA":        "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	"ECDHE-RSA-AES128-SHA":          "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	"ECDHE-ECDSA-AES256-SHA":        "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	"ECDHE-RSA-AES256-SHA":          "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	"AES128-GCM-SHA256":             "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	"AES256-GCM-SHA384":             "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	"AES128-SHA256":                 "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	"AES128-SHA":                    "TLS_RSA_WITH_AES_128_CBC_SHA",
+	"AES256-SHA":                    "TLS_RSA_WITH_AES_256_CBC_SHA",
+	"ECDHE-RSA-DES-CBC3-SHA":        "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	"DES-CBC3-SHA":                  "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+}
+
+// resolveCertFile 将证书相关选项中的文件名解析为证书目录下的路径
+func resolveCertFile(name string) (string, error) {
+	if curlOptions.CertDir == "" {
+		return "", fmt.Errorf("未配置证书目录，不允许使用证书文件: %s", name)
+	}
+	return resolveInDir(curlOptions.CertDir, name)
+}
+
+// readCertFile 读取证书目录下的文件
+func readCertFile(name string) ([]byte, error) {
+	path, err := resolveCertFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("证书文件不存在: %s", name)
+		}
+		return nil, fmt.Errorf("读取证书文件失败: %s", name)
+	}
+	return data, nil
+}
+
+// splitCertPassphrase 拆分 --cert 的 file:passphrase 形式，文件名中的冒号可用反斜杠转义
+func splitCertPassphrase(value string) (string, string) {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ':':
+			sb.WriteByte(':')
+			i++
+		case value[i] == ':':
+			return sb.String(), value[i+1:]
+		default:
+			sb.WriteByte(value[i])
+		}
+	}
+	return sb.String(), ""
+}
+
+// tlsConfig 根据 -k、--cert、--cacert、--pinnedpubkey 等选项构造TLS配置
+func (r *curlRequest) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: r.insecure}
+
+	if r.tlsMinVersion != 0 {
+		config.MinVersion = r.tlsMinVersion
+	}
+	if r.tlsMaxVersion != 0 {
+		config.MaxVersion = r.tlsMaxVersion
+	}
+
+	if r.ciphers != "" {
+		suites, err := parseCipherList(r.ciphers)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = suites
+	}
+
+	// 自定义CA，与curl一样指定后不再使用系统默认证书
+	if r.caCert != "" || r.caPath != "" {
+		pool := x509.NewCertPool()
+		if r.caCert != "" {
+			data, err := readCertFile(r.caCert)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("CA证书文件中没有有效的证书: %s", r.caCert)
+			}
+		}
+		if r.caPath != "" {
+			if err := appendCertDir(pool, r.caPath); err != nil {
+				return nil, err
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	// 客户端证书
+	if r.cert != "" {
+		cert, err := r.loadClientCert()
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	// 公钥固定，即使使用了 -k 也会校验
+	if r.pinnedPubKey != "" {
+		pins, err := parsePinnedPubKey(r.pinnedPubKey)
+		if err != nil {
+			return nil, err
+		}
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("服务器未提供证书，无法校验固定公钥")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+				return nil
+			}
+			return fmt.Errorf("服务器公钥与 --pinnedpubkey 不匹配")
+		}
+	}
+
+	return config, nil
+}
+
+// appendCertDir 将目录中的所有PEM证书加入证书池，对应curl的 --capath
+func appendCertDir(pool *x509.CertPool, dir string) error {
+	path, err := resolveCertFile(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("读取CA证书目录失败: %s", dir)
+	}
+
+	added := false
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if pool.AppendCertsFromPEM(data) {
+			added = true
+		}
+	}
+	if !added {
+		return fmt.Errorf("CA证书目录中没有有效的证书: %s", dir)
+	}
+	return nil
+}
+
+// loadClientCert 加载 --cert/--key 指定的客户端证书，--key 未指定时私钥与证书在同一文件中
+func (r *curlRequest) loadClientCert() (tls.Certificate, error) {
+	certData, err := readCertFile(r.cert)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyData := certData
+	if r.key != "" {
+		if keyData, err = readCertFile(r.key); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	keyPEM, err := decryptKeyPEM(keyData, r.keyPassphrase)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert, err := tls.X509KeyPair(certData, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("加载客户端证书失败: %v", err)
+	}
+	return cert, nil
+}
+
+// decryptKeyPEM 找出PEM数据中的私钥，有口令时解密，返回未加密的私钥PEM
+func decryptKeyPEM(data []byte, passphrase string) ([]byte, error) {
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, fmt.Errorf("未找到私钥")
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if passphrase == "" {
+				return nil, fmt.Errorf("私钥已加密，需要提供口令")
+			}
+			key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(passphrase))
+			if err != nil {
+				return nil, fmt.Errorf("解密私钥失败，请检查口令")
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("解密私钥失败: %v", err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			// 兼容旧式的OpenSSL加密PEM私钥
+			if x509.IsEncryptedPEMBlock(block) {
+				if passphrase == "" {
+					return nil, fmt.Errorf("私钥已加密，需要提供口令")
+				}
+				der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+				if err != nil {
+					return nil, fmt.Errorf("解密私钥失败，请检查口令")
+				}
+				return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+			}
+			return pem.EncodeToMemory(block), nil
+		}
+	}
+}
+
+// parsePinnedPubKey 解析 --pinnedpubkey，支持以分号分隔的多个 sha256//base64 值，
+// 也可以是证书目录下的公钥或证书文件
+func parsePinnedPubKey(value string) (map[string]bool, error) {
+	pins := make(map[string]bool)
+
+	if !strings.HasPrefix(value, "sha256//") {
+		data, err := readCertFile(value)
+		if err != nil {
+			return nil, err
+		}
+		spki, err := publicKeyInfo(data)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(spki)
+		pins[base64.StdEncoding.EncodeToString(sum[:])] = true
+		return pins, nil
+	}
+
+	for _, pin := range strings.Split(value, ";") {
+		pin = strings.TrimSpace(pin)
+		if !strings.HasPrefix(pin, "sha256//") {
+			return nil, fmt.Errorf("无效的 --pinnedpubkey: %s", pin)
+		}
+		pins[strings.TrimPrefix(pin, "sha256//")] = true
+	}
+	return pins, nil
+}
+
+// publicKeyInfo 从PEM或DER格式的公钥/证书中取出SubjectPublicKeyInfo
+func publicKeyInfo(data []byte) ([]byte, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return der, nil
+	}
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return cert.RawSubjectPublicKeyInfo, nil
+	}
+	return nil, fmt.Errorf("无法解析固定公钥文件")
+}
+
+// parseCipherList 解析 --ciphers，支持OpenSSL名称和IANA名称，以冒号、逗号或空格分隔。
+// TLS 1.3的套件在Go中不可配置，会被忽略
+func parseCipherList(value string) ([]uint16, error) {
+	ids := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+
+	var suites []uint16
+	skipped := false
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ',' || r == ' ' }) {
+		if strings.HasPrefix(name, "TLS_AES_") || strings.HasPrefix(name, "TLS_CHACHA20_") {
+			skipped = true
+			continue
+		}
+		if ianaName, ok := opensslCipherNames[strings.ToUpper(name)]; ok {
+			name = ianaName
+		}
+		id, ok := ids[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("不支持的加密套件: %s", name)
+		}
+		suites = append(suites, id)
+	}
+	if len(suites) == 0 && !skipped {
+		return nil, fmt.Errorf("--ciphers 中没有可用的加密套件")
+	}
+	return suites, nil
+}
@@ -0,0 +1,164 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// newClient 根据curl选项创建HTTP客户端
+func (r *curlRequest) newClient() (*http.Client, error) {
+	dialer, err := r.newDialer(&net.Dialer{
+		Timeout:   capTimeout(r.connectTimeout),
+		KeepAlive: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := r.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   capTimeout(r.connectTimeout),
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+		// 与curl一致，只有 --compressed 或自定义Accept-Encoding时才请求压缩，由decompressBody解压
+		DisableCompression: true,
+	}
+
+	// 代理设置
+	proxySettings, err := r.resolveProxy()
+	if err != nil {
+		return nil, err
+	}
+	proxySettings.apply(transport, dialer)
+
+	// 请求头的顺序在连接上调整，HTTPS需要在TLS之上调整，因此自行完成TLS握手，
+	// 经代理时也在自行建立的隧道上握手
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return r.orderHeaders(conn), nil
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := proxySettings.dialTarget(ctx, dialer, "https", network, addr, transport.TLSHandshakeTimeout)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn, err := tlsHandshake(ctx, conn, tlsConfig, addr, transport.TLSHandshakeTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return r.orderHeaders(tlsConn), nil
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       capTimeout(r.maxTime),
+		CheckRedirect: r.checkRedirect,
+	}, nil
+}
+
+// tlsHandshake 在连接上完成TLS握手，SNI使用请求URL中的主机名，并触发httptrace的握手钩子
+func tlsHandshake(ctx context.Context, conn net.Conn, config *tls.Config, addr string, timeout time.Duration) (*tls.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err = tlsConn.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// checkRedirect 与curl一致：未指定 -L 时不跟随重定向，直接返回3xx响应；
+// 指定 -L 时最多跟随 --max-redirs 次
+func (r *curlRequest) checkRedirect(req *http.Request, via []*http.Request) error {
+	if !r.followRedirects {
+		return http.ErrUseLastResponse
+	}
+	if r.maxRedirs >= 0 && len(via) > r.maxRedirs {
+		return fmt.Errorf("已达到最大重定向次数(%d)", r.maxRedirs)
+	}
+	if r.trace != nil && req.Response != nil {
+		r.trace.redirectChain = append(r.trace.redirectChain, req.Response)
+	}
+	if r.autoReferer && !r.hasHeader("Referer") {
+		req.Header.Set("Referer", via[len(via)-1].URL.String())
+	}
+	return nil
+}
+
+// newRequest 创建一次请求，每次重试都重新创建以便重新发送请求体
+func (r *curlRequest) newRequest(body []byte, contentType string) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(r.method, r.url, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+
+	// 添加头信息
+	r.applyHeaders(req)
+	if len(r.cookies) > 0 {
+		req.Header.Add("Cookie", strings.Join(r.cookies, "; "))
+	}
+	if r.compressed && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", curlAcceptEncoding)
+	}
+	r.applyAuth(req)
+
+	// 未指定Content-Type时使用请求体对应的默认值；
+	// 用户自定义了multipart类型但未带boundary时，与curl一样自动补上
+	if contentType != "" {
+		userType := req.Header.Get("Content-Type")
+		switch {
+		case r.headerRemoved("Content-Type"):
+		case userType == "":
+			req.Header.Set("Content-Type", contentType)
+		case len(r.forms) > 0 && !strings.Contains(userType, "boundary="):
+			req.Header.Set("Content-Type", userType+contentType[strings.Index(contentType, ";"):])
+		}
+	}
+	r.removeHeaders(req)
+
+	return req, nil
+}
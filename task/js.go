@@ -0,0 +1,289 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// JSOptions 内置JavaScript引擎任务的运行选项，由配置文件在服务启动时设置
+type JSOptions struct {
+	// Timeout 脚本的最长运行时间，超时后中断脚本
+	Timeout time.Duration
+	// MaxMemoryMB 脚本运行期间堆内存增长的上限（MB），也是单个字符串长度的上限。
+	// 大于0时JavaScript任务逐个执行，堆内存的增长才能归属于正在执行的脚本
+	MaxMemoryMB int
+	// MaxOutput 日志输出保留的最大字节数
+	MaxOutput int
+}
+
+// 当前生效的JavaScript任务选项
+var jsOptions JSOptions
+
+// SetJSOptions 设置内置JavaScript引擎任务的运行选项
+func SetJSOptions(opts JSOptions) {
+	jsOptions = opts
+}
+
+// 脚本最大调用深度，防止无限递归耗尽栈空间
+const jsMaxCallStackSize = 1024
+
+// 检查堆内存增长的间隔
+const jsMemoryCheckInterval = 50 * time.Millisecond
+
+// jsSlot 限制内存时同一时间只执行一个JavaScript任务
+var jsSlot = make(chan struct{}, 1)
+
+// jsGuardScript 在脚本之前执行，一次就能分配大量内存的内置方法在分配之前检查长度，
+// 超过上限时抛出RangeError，不必等到下一次检查堆内存
+const jsGuardScript = `(function (limit) {
+	function check(length) {
+		if (length > limit) {
+			throw new RangeError("字符串长度超过内存上限");
+		}
+	}
+	function wrap(proto, name, size) {
+		var original = proto[name];
+		Object.defineProperty(proto, name, {
+			value: function () {
+				check(size.apply(this, arguments));
+				return original.apply(this, arguments);
+			},
+			writable: true,
+			configurable: true
+		});
+	}
+	wrap(String.prototype, "repeat", function (count) { return String(this).length * Number(count); });
+	wrap(String.prototype, "padStart", function (length) { return Number(length); });
+	wrap(String.prototype, "padEnd", function (length) { return Number(length); });
+	wrap(Array.prototype, "join", function (sep) {
+		return (this.length - 1) * (sep === undefined ? 1 : String(sep).length);
+	});
+})`
+
+// 中断脚本的原因
+const (
+	jsInterruptTimeout   = "timeout"
+	jsInterruptMemory    = "memory"
+	jsInterruptCancelled = "cancelled"
+)
+
+// JSTask 在内置的JavaScript引擎中执行脚本，不依赖Node.js。
+// 每次执行使用全新的虚拟机，脚本通过全局变量args读取参数、input读取输入，
+// 可以使用http.request、crypto和log等宿主API，最后一个表达式的值作为结果返回
+type JSTask struct {
+	Script string   `json:"command" desc:"脚本内容"`
+	Args   []string `json:"args,omitempty" desc:"脚本的命令行参数"`
+	Stdin  string   `json:"stdin,omitempty" desc:"写入脚本标准输入的内容"`
+}
+
+// NewJSTask 创建JavaScript引擎任务
+func NewJSTask(script string, args []string, stdin string) *JSTask {
+	return &JSTask{Script: script, Args: args, Stdin: stdin}
+}
+
+// Validate 检查脚本内容
+func (t *JSTask) Validate() error {
+	if strings.TrimSpace(t.Script) == "" {
+		return fmt.Errorf("脚本内容为空")
+	}
+	return nil
+}
+
+// Execute 执行脚本，脚本抛出异常、超时或内存超限时在结果中返回失败原因
+func (t *JSTask) Execute(ctx context.Context) (*Result, error) {
+	result, err := t.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("执行JavaScript脚本失败: %v", err)
+	}
+	res := &Result{Data: result}
+	if failure := result.Failure(); failure != nil {
+		res.Failure = fmt.Errorf("JavaScript脚本执行失败: %v", failure)
+	}
+	return res, nil
+}
+
+// Redacted 返回脚本的摘要
+func (t *JSTask) Redacted() string {
+	return RedactScript(t.Script)
+}
+
+// Run 执行脚本，返回日志输出、脚本结果和执行状态。ctx取消或到期时中断脚本
+func (t *JSTask) Run(ctx context.Context) (*ScriptResult, error) {
+	if strings.TrimSpace(t.Script) == "" {
+		return nil, fmt.Errorf("脚本内容为空")
+	}
+
+	program, err := goja.Compile("main.js", t.Script, false)
+	if err != nil {
+		return nil, fmt.Errorf("脚本语法错误: %v", err)
+	}
+
+	// 堆内存是整个进程共享的，限制内存时等待其他JavaScript任务结束后再执行
+	if jsOptions.MaxMemoryMB > 0 {
+		select {
+		case jsSlot <- struct{}{}:
+			defer func() { <-jsSlot }()
+		case <-ctx.Done():
+			return &ScriptResult{
+				ExitCode:  1,
+				TimedOut:  ctx.Err() == context.DeadlineExceeded,
+				Cancelled: ctx.Err() == context.Canceled,
+			}, nil
+		}
+	}
+
+	start := time.Now()
+	rt := newJSRuntime(ctx, start.Add(jsOptions.Timeout), jsOptions.MaxOutput)
+	vm := rt.vm
+	if jsOptions.MaxMemoryMB > 0 {
+		if err := rt.guardAllocations(jsOptions.MaxMemoryMB << 20); err != nil {
+			return nil, err
+		}
+	}
+	vm.Set("args", t.Args)
+	vm.Set("input", t.Stdin)
+
+	// 超时和内存超限时中断脚本
+	if jsOptions.Timeout > 0 {
+		timer := time.AfterFunc(jsOptions.Timeout, func() { vm.Interrupt(jsInterruptTimeout) })
+		defer timer.Stop()
+	}
+	stopCtx := context.AfterFunc(ctx, func() {
+		if ctx.Err() == context.DeadlineExceeded {
+			vm.Interrupt(jsInterruptTimeout)
+		} else {
+			vm.Interrupt(jsInterruptCancelled)
+		}
+	})
+	defer stopCtx()
+	if jsOptions.MaxMemoryMB > 0 {
+		stop := watchHeapGrowth(uint64(jsOptions.MaxMemoryMB)<<20, func() { vm.Interrupt(jsInterruptMemory) })
+		defer stop()
+	}
+
+	result := &ScriptResult{}
+	value, err := vm.RunProgram(program)
+	if err == nil {
+		result.Result, err = rt.exportValue(value)
+	}
+	if err != nil {
+		result.ExitCode = 1
+		var interrupted *goja.InterruptedError
+		var exception *goja.Exception
+		var overflow *goja.StackOverflowError
+		switch {
+		case errors.As(err, &interrupted):
+			switch interrupted.Value() {
+			case jsInterruptTimeout:
+				result.TimedOut = true
+			case jsInterruptMemory:
+				result.MemoryExceeded = true
+			case jsInterruptCancelled:
+				result.Cancelled = true
+			}
+		case errors.As(err, &overflow):
+			// 调用栈很深，只输出错误信息
+			rt.stderr.Write([]byte("RangeError: 超过最大调用深度\n"))
+		case errors.As(err, &exception):
+			rt.stderr.Write([]byte(exception.String() + "\n"))
+		default:
+			rt.stderr.Write([]byte(err.Error() + "\n"))
+		}
+	}
+
+	result.DurationMs = roundMillis(time.Since(start))
+	result.Stdout = rt.stdout.String()
+	result.Stderr = rt.stderr.String()
+	result.Truncated = rt.stdout.truncated || rt.stderr.truncated
+	return result, nil
+}
+
+// exportValue 在虚拟机中用JSON.stringify转换脚本结果，Promise取其完成后的值。
+// 函数、循环引用的对象、BigInt等无法转换为JSON的结果返回错误
+func (rt *jsRuntime) exportValue(value goja.Value) (interface{}, error) {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil, nil
+	}
+	if promise, ok := value.Export().(*goja.Promise); ok {
+		switch promise.State() {
+		case goja.PromiseStateFulfilled:
+			return rt.exportValue(promise.Result())
+		case goja.PromiseStateRejected:
+			return nil, fmt.Errorf("Promise被拒绝: %v", promise.Result())
+		default:
+			return nil, fmt.Errorf("脚本结束时Promise仍未完成")
+		}
+	}
+
+	data, err := rt.stringify(goja.Undefined(), value)
+	if err != nil {
+		return nil, fmt.Errorf("脚本结果无法转换为JSON: %v", err)
+	}
+	if goja.IsUndefined(data) {
+		return nil, fmt.Errorf("脚本结果无法转换为JSON: 不支持的值 %s", value.String())
+	}
+	return json.RawMessage(data.String()), nil
+}
+
+// guardAllocations 执行jsGuardScript，限制单个字符串的长度
+func (rt *jsRuntime) guardAllocations(limit int) error {
+	guard, err := rt.vm.RunString(jsGuardScript)
+	if err != nil {
+		return fmt.Errorf("初始化内存限制失败: %v", err)
+	}
+	install, _ := goja.AssertFunction(guard)
+	if _, err := install(goja.Undefined(), rt.vm.ToValue(limit)); err != nil {
+		return fmt.Errorf("初始化内存限制失败: %v", err)
+	}
+	rt.maxString = limit
+	return nil
+}
+
+// watchHeapGrowth 定期检查堆内存，比开始时增长超过limit时调用onExceed，返回停止检查的函数。
+// 堆内存是整个agent进程共享的，JavaScript任务逐个执行，但同时运行的curl等其他任务也会计入；
+// 超过时先执行一次GC，排除已经不再使用的内存后仍超过才调用onExceed
+func watchHeapGrowth(limit uint64, onExceed func()) func() {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	heapBytes := func() uint64 {
+		metrics.Read(sample)
+		if sample[0].Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+		return sample[0].Value.Uint64()
+	}
+
+	baseline := heapBytes()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jsMemoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				exceeded := func() bool {
+					current := heapBytes()
+					return current > baseline && current-baseline > limit
+				}
+				if exceeded() {
+					runtime.GC()
+					if exceeded() {
+						onExceed()
+						return
+					}
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,425 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// jsRuntime 一次JavaScript任务使用的虚拟机及其宿主API
+type jsRuntime struct {
+	vm       *goja.Runtime
+	stdout   *limitedBuffer
+	stderr   *limitedBuffer
+	deadline time.Time // 脚本的截止时间，http.request的超时不会超过它
+	// ctx 任务的上下文，取消时中止脚本中正在进行的请求
+	ctx context.Context
+	// maxString 宿主API接受的字符串长度上限，0表示不限制
+	maxString int
+	// stringify 脚本执行前的JSON.stringify，用于转换脚本结果，脚本修改全局的JSON不影响结果
+	stringify goja.Callable
+}
+
+// newJSRuntime 创建虚拟机并注册宿主API
+func newJSRuntime(ctx context.Context, deadline time.Time, maxOutput int) *jsRuntime {
+	rt := &jsRuntime{
+		vm:       goja.New(),
+		stdout:   &limitedBuffer{limit: maxOutput},
+		stderr:   &limitedBuffer{limit: maxOutput},
+		deadline: deadline,
+		ctx:      ctx,
+	}
+	rt.vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	rt.vm.SetMaxCallStackSize(jsMaxCallStackSize)
+	rt.stringify, _ = goja.AssertFunction(rt.vm.Get("JSON").ToObject(rt.vm).Get("stringify"))
+
+	// log(...) 与 log.info(...) 写入stdout，log.error(...) 写入stderr；console同样可用
+	info, errorLog := rt.logTo(rt.stdout), rt.logTo(rt.stderr)
+	logFunc := rt.vm.ToValue(info).(*goja.Object)
+	logFunc.Set("info", info)
+	logFunc.Set("error", errorLog)
+	rt.vm.Set("log", logFunc)
+	console := rt.vm.NewObject()
+	console.Set("log", info)
+	console.Set("info", info)
+	console.Set("error", errorLog)
+	rt.vm.Set("console", console)
+
+	httpObj := rt.vm.NewObject()
+	httpObj.Set("request", rt.httpRequest)
+	rt.vm.Set("http", httpObj)
+
+	rt.vm.Set("crypto", rt.cryptoObject())
+	return rt
+}
+
+// logTo 返回把参数以空格连接后写入一行日志的函数
+func (rt *jsRuntime) logTo(buf *limitedBuffer) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		parts := make([]string, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			parts[i] = rt.formatLogArg(arg)
+		}
+		buf.Write([]byte(strings.Join(parts, " ") + "\n"))
+		return goja.Undefined()
+	}
+}
+
+// formatLogArg 对象和数组按JSON输出，其他值按字符串输出
+func (rt *jsRuntime) formatLogArg(v goja.Value) string {
+	if obj, ok := v.(*goja.Object); ok && obj.ClassName() != "Function" && obj.ClassName() != "Error" {
+		if data, err := json.Marshal(obj.Export()); err == nil {
+			return string(data)
+		}
+	}
+	return v.String()
+}
+
+// httpRequest 实现 http.request，使用curl任务的解析和传输逻辑发送请求。参数可以是：
+//
+//	"curl ..."  完整的curl命令
+//	{url, method, headers, body, timeout, follow, insecure, options}
+//
+// 返回与curl任务相同的结构化结果
+func (rt *jsRuntime) httpRequest(call goja.FunctionCall) goja.Value {
+	rt.checkSize(call.Arguments...)
+	var args []string
+	switch v := call.Argument(0).Export().(type) {
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "curl") {
+			panic(rt.vm.NewGoError(fmt.Errorf("命令必须以curl开头")))
+		}
+		cr, err := parseCurlCommand(strings.TrimSpace(v))
+		if err != nil {
+			panic(rt.vm.NewGoError(err))
+		}
+		return rt.doRequest(cr)
+	case map[string]interface{}:
+		rt.checkSize(rt.vm.ToValue(v["body"]))
+		var err error
+		if args, err = requestArgs(v); err != nil {
+			panic(rt.vm.NewGoError(err))
+		}
+	default:
+		panic(rt.vm.NewTypeError("http.request 的参数必须是curl命令或请求对象"))
+	}
+
+	cr, err := parseCurlArgs(args)
+	if err != nil {
+		panic(rt.vm.NewGoError(err))
+	}
+	return rt.doRequest(cr)
+}
+
+// doRequest 发送请求，超时时间不超过脚本剩余的运行时间
+func (rt *jsRuntime) doRequest(cr *curlRequest) goja.Value {
+	if !rt.deadline.IsZero() && jsOptions.Timeout > 0 {
+		remaining := time.Until(rt.deadline)
+		if remaining <= 0 {
+			panic(rt.vm.NewGoError(fmt.Errorf("脚本已超时")))
+		}
+		if cr.maxTime <= 0 || cr.maxTime > remaining {
+			cr.maxTime = remaining
+		}
+	}
+
+	// 与curl任务一样，-u的密码、令牌等凭据不会出现在交给脚本的结果和错误信息中
+	result, err := cr.execute(rt.ctx)
+	if err != nil {
+		panic(rt.vm.NewGoError(cr.maskError(err)))
+	}
+	maskResult(result, cr.secrets)
+	return rt.vm.ToValue(result)
+}
+
+// requestArgs 将请求对象转换为curl参数
+func requestArgs(opts map[string]interface{}) ([]string, error) {
+	url, _ := opts["url"].(string)
+	if url == "" {
+		return nil, fmt.Errorf("请求对象缺少url")
+	}
+	args := []string{"--url", url}
+
+	if method, ok := opts["method"].(string); ok && method != "" {
+		args = append(args, "-X", strings.ToUpper(method))
+	}
+
+	hasContentType := false
+	addHeader := func(name, value string) {
+		if strings.EqualFold(name, "Content-Type") {
+			hasContentType = true
+		}
+		args = append(args, "-H", name+": "+value)
+	}
+	switch headers := opts["headers"].(type) {
+	case map[string]interface{}:
+		// 对象的键没有顺序，按名称排序保证每次发送的顺序一致；需要指定顺序时使用数组
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			addHeader(name, fmt.Sprint(headers[name]))
+		}
+	case []interface{}:
+		for _, h := range headers {
+			line := fmt.Sprint(h)
+			name, value, _ := strings.Cut(line, ":")
+			addHeader(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	switch body := opts["body"].(type) {
+	case nil:
+	case string:
+		args = append(args, "--data-raw", body)
+	default:
+		// 对象按JSON发送
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求体失败: %v", err)
+		}
+		if !hasContentType {
+			args = append(args, "-H", "Content-Type: application/json")
+		}
+		args = append(args, "--data-raw", string(data))
+	}
+
+	if timeout, ok := opts["timeout"]; ok {
+		args = append(args, "-m", fmt.Sprint(timeout))
+	}
+	if follow, _ := opts["follow"].(bool); follow {
+		args = append(args, "-L")
+	}
+	if insecure, _ := opts["insecure"].(bool); insecure {
+		args = append(args, "-k")
+	}
+	// options 为额外的curl选项，如 ["--compressed", "-x", "socks5h://127.0.0.1:1080"]
+	if options, ok := opts["options"].([]interface{}); ok {
+		for _, opt := range options {
+			args = append(args, fmt.Sprint(opt))
+		}
+	}
+	return args, nil
+}
+
+// 支持的摘要算法
+var jsHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// cryptoObject 创建crypto对象。密钥、IV等参数默认按UTF-8取字节，
+// 带 hex: 或 base64: 前缀时按对应编码解码
+func (rt *jsRuntime) cryptoObject() *goja.Object {
+	obj := rt.vm.NewObject()
+	for name, newHash := range jsHashes {
+		obj.Set(name, func(data string) string {
+			rt.checkSize(rt.vm.ToValue(data))
+			h := newHash()
+			h.Write([]byte(data))
+			return hex.EncodeToString(h.Sum(nil))
+		})
+	}
+	obj.Set("hmac", func(algorithm, key, data string) (string, error) {
+		rt.checkSize(rt.vm.ToValue(key), rt.vm.ToValue(data))
+		newHash, ok := jsHashes[strings.ToLower(algorithm)]
+		if !ok {
+			return "", fmt.Errorf("不支持的摘要算法: %s", algorithm)
+		}
+		keyBytes, err := decodeJSBytes(key)
+		if err != nil {
+			return "", err
+		}
+		mac := hmac.New(newHash, keyBytes)
+		mac.Write([]byte(data))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	})
+	obj.Set("base64Encode", func(data string) string {
+		rt.checkSize(rt.vm.ToValue(data))
+		return base64.StdEncoding.EncodeToString([]byte(data))
+	})
+	obj.Set("base64Decode", func(data string) (string, error) {
+		rt.checkSize(rt.vm.ToValue(data))
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", fmt.Errorf("base64解码失败: %v", err)
+		}
+		return string(decoded), nil
+	})
+	obj.Set("aesEncrypt", func(plaintext, key, iv, mode string) (string, error) {
+		rt.checkSize(rt.vm.ToValue(plaintext))
+		return aesEncrypt(plaintext, key, iv, mode)
+	})
+	obj.Set("aesDecrypt", func(ciphertext, key, iv, mode string) (string, error) {
+		rt.checkSize(rt.vm.ToValue(ciphertext))
+		return aesDecrypt(ciphertext, key, iv, mode)
+	})
+	return obj
+}
+
+// checkSize 宿主API的字符串参数超过长度上限时抛出异常，
+// 防止宿主API复制或编码时一次分配大量内存
+func (rt *jsRuntime) checkSize(args ...goja.Value) {
+	if rt.maxString <= 0 {
+		return
+	}
+	for _, arg := range args {
+		if s, ok := arg.Export().(string); ok && len(s) > rt.maxString {
+			panic(rt.vm.NewGoError(fmt.Errorf("参数长度超过内存上限（%d字节）", rt.maxString)))
+		}
+	}
+}
+
+// decodeJSBytes 按前缀解码脚本传入的二进制参数
+func decodeJSBytes(s string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(s, "hex:"):
+		b, err := hex.DecodeString(s[4:])
+		if err != nil {
+			return nil, fmt.Errorf("hex解码失败: %v", err)
+		}
+		return b, nil
+	case strings.HasPrefix(s, "base64:"):
+		b, err := base64.StdEncoding.DecodeString(s[7:])
+		if err != nil {
+			return nil, fmt.Errorf("base64解码失败: %v", err)
+		}
+		return b, nil
+	}
+	return []byte(s), nil
+}
+
+// aesEncrypt 使用AES加密，mode为cbc（默认）、ecb或gcm，CBC和ECB使用PKCS#7填充，
+// GCM的iv为nonce。返回base64编码的密文
+func aesEncrypt(plaintext, key, iv, mode string) (string, error) {
+	block, ivBytes, err := aesCipher(key, iv)
+	if err != nil {
+		return "", err
+	}
+
+	var out []byte
+	switch strings.ToLower(mode) {
+	case "", "cbc":
+		if len(ivBytes) != aes.BlockSize {
+			return "", fmt.Errorf("CBC模式的IV必须为%d字节", aes.BlockSize)
+		}
+		data := pkcs7Pad([]byte(plaintext), aes.BlockSize)
+		out = make([]byte, len(data))
+		cipher.NewCBCEncrypter(block, ivBytes).CryptBlocks(out, data)
+	case "ecb":
+		data := pkcs7Pad([]byte(plaintext), aes.BlockSize)
+		out = make([]byte, len(data))
+		for i := 0; i < len(data); i += aes.BlockSize {
+			block.Encrypt(out[i:], data[i:i+aes.BlockSize])
+		}
+	case "gcm":
+		gcm, err := cipher.NewGCMWithNonceSize(block, len(ivBytes))
+		if err != nil {
+			return "", fmt.Errorf("创建GCM失败: %v", err)
+		}
+		out = gcm.Seal(nil, ivBytes, []byte(plaintext), nil)
+	default:
+		return "", fmt.Errorf("不支持的AES模式: %s", mode)
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// aesDecrypt 解密aesEncrypt生成的base64密文
+func aesDecrypt(ciphertext, key, iv, mode string) (string, error) {
+	block, ivBytes, err := aesCipher(key, iv)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("base64解码失败: %v", err)
+	}
+
+	var out []byte
+	switch strings.ToLower(mode) {
+	case "", "cbc", "ecb":
+		if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return "", fmt.Errorf("密文长度无效")
+		}
+		out = make([]byte, len(data))
+		if strings.ToLower(mode) == "ecb" {
+			for i := 0; i < len(data); i += aes.BlockSize {
+				block.Decrypt(out[i:], data[i:i+aes.BlockSize])
+			}
+		} else {
+			if len(ivBytes) != aes.BlockSize {
+				return "", fmt.Errorf("CBC模式的IV必须为%d字节", aes.BlockSize)
+			}
+			cipher.NewCBCDecrypter(block, ivBytes).CryptBlocks(out, data)
+		}
+		if out, err = pkcs7Unpad(out, aes.BlockSize); err != nil {
+			return "", err
+		}
+	case "gcm":
+		gcm, err := cipher.NewGCMWithNonceSize(block, len(ivBytes))
+		if err != nil {
+			return "", fmt.Errorf("创建GCM失败: %v", err)
+		}
+		if out, err = gcm.Open(nil, ivBytes, data, nil); err != nil {
+			return "", fmt.Errorf("解密失败: %v", err)
+		}
+	default:
+		return "", fmt.Errorf("不支持的AES模式: %s", mode)
+	}
+	return string(out), nil
+}
+
+func aesCipher(key, iv string) (cipher.Block, []byte, error) {
+	keyBytes, err := decodeJSBytes(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("AES密钥长度必须为16、24或32字节，当前为%d字节", len(keyBytes))
+	}
+	ivBytes, err := decodeJSBytes(iv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, ivBytes, nil
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	return append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > blockSize || padding > len(data) {
+		return nil, fmt.Errorf("解密失败: 填充无效")
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("解密失败: 填充无效")
+		}
+	}
+	return data[:len(data)-padding], nil
+}
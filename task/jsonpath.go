@@ -0,0 +1,178 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathToken JSONPath中的一级访问：对象的键、数组下标或通配符
+type jsonPathToken struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath 解析JSONPath的常用子集：
+//
+//	$.data.token      对象的键，开头的 $ 可以省略
+//	$['a.b']["c"]     带引号的键，可包含点号等特殊字符
+//	$.list[0]         数组下标，负数表示从末尾计数
+//	$.list[*].id      通配符，匹配对象的所有值或数组的所有元素
+func parseJSONPath(path string) ([]jsonPathToken, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	if p != "" && p[0] != '.' && p[0] != '[' {
+		p = "." + p
+	}
+
+	var tokens []jsonPathToken
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			key := p[:end]
+			if key == "" {
+				return nil, fmt.Errorf("无效的JSONPath: %s", path)
+			}
+			if key == "*" {
+				tokens = append(tokens, jsonPathToken{wildcard: true})
+			} else {
+				tokens = append(tokens, jsonPathToken{key: key})
+			}
+			p = p[end:]
+
+		case '[':
+			if len(p) > 1 && (p[1] == '\'' || p[1] == '"') {
+				quote := p[1]
+				end := strings.IndexByte(p[2:], quote)
+				if end == -1 || len(p) < end+4 || p[end+3] != ']' {
+					return nil, fmt.Errorf("无效的JSONPath: %s", path)
+				}
+				tokens = append(tokens, jsonPathToken{key: p[2 : end+2]})
+				p = p[end+4:]
+				continue
+			}
+			end := strings.IndexByte(p, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("无效的JSONPath: %s", path)
+			}
+			inner := strings.TrimSpace(p[1:end])
+			if inner == "*" {
+				tokens = append(tokens, jsonPathToken{wildcard: true})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("无效的JSONPath数组下标: %s", inner)
+				}
+				tokens = append(tokens, jsonPathToken{index: index, isIndex: true})
+			}
+			p = p[end+1:]
+
+		default:
+			return nil, fmt.Errorf("无效的JSONPath: %s", path)
+		}
+	}
+	return tokens, nil
+}
+
+// evalJSONPath 在JSON文档中查找path对应的值。路径中包含通配符时返回所有匹配值组成的数组，
+// 没有匹配时第二个返回值为false
+func evalJSONPath(doc interface{}, path string) (interface{}, bool, error) {
+	tokens, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	values := []interface{}{doc}
+	wildcard := false
+	for _, token := range tokens {
+		var next []interface{}
+		for _, value := range values {
+			switch node := value.(type) {
+			case map[string]interface{}:
+				if token.wildcard {
+					for _, key := range sortedKeys(node) {
+						next = append(next, node[key])
+					}
+				} else if child, ok := node[token.key]; ok && !token.isIndex {
+					next = append(next, child)
+				}
+			case []interface{}:
+				switch {
+				case token.wildcard:
+					next = append(next, node...)
+				case token.isIndex:
+					index := token.index
+					if index < 0 {
+						index += len(node)
+					}
+					if index >= 0 && index < len(node) {
+						next = append(next, node[index])
+					}
+				}
+			}
+		}
+		wildcard = wildcard || token.wildcard
+		values = next
+	}
+
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	if wildcard {
+		return values, true, nil
+	}
+	return values[0], true, nil
+}
+
+// sortedKeys 返回排序后的对象键，使通配符的结果顺序固定
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseJSONBody 解析响应体，数字保留原始文本，避免较大的整数ID损失精度
+func parseJSONBody(body string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("响应体不是有效的JSON: %v", err)
+	}
+	return doc, nil
+}
+
+// jsonValueString 将JSON值转换为字符串：字符串和数字取原始值，对象和数组输出为JSON
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,115 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NodeOptions Node.js任务的运行选项，由配置文件在服务启动时设置
+type NodeOptions struct {
+	// Binary node可执行文件的路径，为空时从PATH中查找node
+	Binary string
+	// WorkDir 任务临时工作目录的父目录，为空时使用系统临时目录
+	WorkDir string
+	// Timeout 脚本的最长运行时间，超时后结束整个进程组
+	Timeout time.Duration
+	// MaxMemoryMB 脚本进程的内存上限（MB），同时作为V8堆大小的上限
+	MaxMemoryMB int
+	// MaxOutput stdout、stderr各自保留的最大字节数
+	MaxOutput int
+}
+
+// 当前生效的Node.js任务选项
+var nodeOptions NodeOptions
+
+// SetNodeOptions 设置Node.js任务的运行选项
+func SetNodeOptions(opts NodeOptions) {
+	nodeOptions = opts
+}
+
+// NodeTask 执行一段Node.js脚本。脚本保存为临时工作目录下的main.js，
+// Args通过process.argv.slice(2)读取，Stdin写入脚本的标准输入
+type NodeTask struct {
+	Script string   `json:"command" desc:"脚本内容"`
+	Args   []string `json:"args,omitempty" desc:"脚本的命令行参数"`
+	Stdin  string   `json:"stdin,omitempty" desc:"写入脚本标准输入的内容"`
+}
+
+// NewNodeTask 创建Node.js脚本任务
+func NewNodeTask(script string, args []string, stdin string) *NodeTask {
+	return &NodeTask{Script: script, Args: args, Stdin: stdin}
+}
+
+// Validate 检查脚本内容
+func (t *NodeTask) Validate() error {
+	if strings.TrimSpace(t.Script) == "" {
+		return fmt.Errorf("脚本内容为空")
+	}
+	return nil
+}
+
+// Execute 执行脚本，脚本超时、内存超限或退出码不为0时在结果中返回失败原因
+func (t *NodeTask) Execute(ctx context.Context) (*Result, error) {
+	result, err := t.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("执行Node.js脚本失败: %v", err)
+	}
+	res := &Result{Data: result}
+	if failure := result.Failure(); failure != nil {
+		res.Failure = fmt.Errorf("Node.js脚本执行失败: %v", failure)
+	}
+	return res, nil
+}
+
+// Redacted 返回脚本的摘要
+func (t *NodeTask) Redacted() string {
+	return RedactScript(t.Script)
+}
+
+// Run 执行脚本，返回包含stdout、stderr和退出码的结果。ctx取消或到期时结束脚本进程
+func (t *NodeTask) Run(ctx context.Context) (*ScriptResult, error) {
+	if strings.TrimSpace(t.Script) == "" {
+		return nil, fmt.Errorf("脚本内容为空")
+	}
+
+	// 每个任务使用独立的临时工作目录，执行结束后删除
+	dir, err := os.MkdirTemp(nodeOptions.WorkDir, "node-task-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时工作目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "main.js"), []byte(t.Script), 0600); err != nil {
+		return nil, fmt.Errorf("写入脚本文件失败: %v", err)
+	}
+
+	binary := nodeOptions.Binary
+	if binary == "" {
+		binary = "node"
+	}
+
+	var args []string
+	if nodeOptions.MaxMemoryMB > 0 {
+		args = append(args, fmt.Sprintf("--max-old-space-size=%d", nodeOptions.MaxMemoryMB))
+	}
+	args = append(args, "main.js")
+	args = append(args, t.Args...)
+
+	return runScript(ctx, scriptCommand{
+		Path:  binary,
+		Args:  args,
+		Dir:   dir,
+		Env:   scriptEnv(dir),
+		Stdin: t.Stdin,
+		Limits: scriptLimits{
+			Timeout:   nodeOptions.Timeout,
+			MaxMemory: uint64(nodeOptions.MaxMemoryMB) << 20,
+			MaxOutput: nodeOptions.MaxOutput,
+		},
+	})
+}
@@ -0,0 +1,106 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CurlOptions curl任务的运行选项，由配置文件在服务启动时设置
+type CurlOptions struct {
+	// FileDir 允许任务读取文件的目录，为空时禁止读取任何文件
+	FileDir string
+	// CookieDir 保存cookie jar文件的目录，为空时禁止使用cookie文件
+	CookieDir string
+	// MaxTimeout 任务可使用的最长超时时间，-m、--connect-timeout、
+	// --retry-delay、--retry-max-time 都不能超过该值，未指定 -m 时也以此作为超时
+	MaxTimeout time.Duration
+	// Proxy 默认代理，任务未指定 -x 时使用
+	Proxy string
+	// NoProxy 默认不经过代理的主机列表，任务未指定 --noproxy 时使用
+	NoProxy string
+	// CertDir 证书目录，--cert、--key、--cacert 等选项只能引用该目录下的文件
+	CertDir string
+	// MaxBodySize 响应体（包括解压后）的大小上限（字节），0表示不限制
+	MaxBodySize int64
+}
+
+// capTimeout 将任务指定的超时限制在配置的上限之内，d为0表示使用上限
+func capTimeout(d time.Duration) time.Duration {
+	max := curlOptions.MaxTimeout
+	if max <= 0 {
+		return d
+	}
+	if d <= 0 || d > max {
+		return max
+	}
+	return d
+}
+
+// 当前生效的curl任务选项
+var curlOptions CurlOptions
+
+// SetCurlOptions 设置curl任务的运行选项
+func SetCurlOptions(opts CurlOptions) {
+	curlOptions = opts
+}
+
+// resolveTaskFile 将任务中引用的文件名解析为允许目录下的绝对路径，
+// 拒绝通过 .. 或符号链接访问目录之外的文件
+func resolveTaskFile(name string) (string, error) {
+	if curlOptions.FileDir == "" {
+		return "", fmt.Errorf("未配置任务文件目录，不允许读取文件: %s", name)
+	}
+	return resolveInDir(curlOptions.FileDir, name)
+}
+
+// resolveInDir 将文件名解析为dir目录下的绝对路径，文件可以尚不存在
+func resolveInDir(dir, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("文件名为空")
+	}
+
+	baseDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("获取目录绝对路径失败: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(baseDir); err == nil {
+		baseDir = resolved
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("文件不在允许的目录中: %s", name)
+	}
+
+	return path, nil
+}
+
+// readTaskFile 读取允许目录下的文件内容
+func readTaskFile(name string) ([]byte, error) {
+	path, err := resolveTaskFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("文件不存在: %s", name)
+		}
+		return nil, fmt.Errorf("读取文件失败: %s", name)
+	}
+	return data, nil
+}
@@ -0,0 +1,260 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PythonOptions Python任务的运行选项，由配置文件在服务启动时设置
+type PythonOptions struct {
+	// Binary Python解释器路径，用于创建虚拟环境；未配置虚拟环境时直接用它运行脚本
+	Binary string
+	// VenvDir agent共用的虚拟环境目录，为空时不使用虚拟环境，也不允许安装依赖
+	VenvDir string
+	// WorkDir 任务临时工作目录的父目录，为空时使用系统临时目录
+	WorkDir string
+	// Timeout 脚本的最长运行时间，超时后结束整个进程组
+	Timeout time.Duration
+	// InstallTimeout 创建虚拟环境和安装依赖的最长时间
+	InstallTimeout time.Duration
+	// MaxMemoryMB 脚本进程的内存上限（MB）
+	MaxMemoryMB int
+	// MaxOutput stdout、stderr各自保留的最大字节数
+	MaxOutput int
+}
+
+// 当前生效的Python任务选项
+var pythonOptions PythonOptions
+
+// SetPythonOptions 设置Python任务的运行选项
+func SetPythonOptions(opts PythonOptions) {
+	pythonOptions = opts
+}
+
+// 虚拟环境中记录已安装依赖的文件
+const venvRequirementsFile = "agent-requirements.json"
+
+// venvMu 保证同一时间只有一个任务在创建虚拟环境或安装依赖
+var venvMu sync.Mutex
+
+// PythonTask 执行一段Python脚本。脚本保存为临时工作目录下的main.py，
+// Args通过sys.argv[1:]读取，Stdin写入脚本的标准输入。
+// Requirements 为需要的依赖（pip的需求格式），会安装到agent共用的虚拟环境中并在之后的任务中复用
+type PythonTask struct {
+	Script       string   `json:"command" desc:"脚本内容"`
+	Args         []string `json:"args,omitempty" desc:"脚本的命令行参数"`
+	Stdin        string   `json:"stdin,omitempty" desc:"写入脚本标准输入的内容"`
+	Requirements []string `json:"requirements,omitempty" desc:"需要的依赖（pip的需求格式），安装到agent共用的虚拟环境中"`
+}
+
+// NewPythonTask 创建Python脚本任务
+func NewPythonTask(script string, args []string, stdin string, requirements []string) *PythonTask {
+	return &PythonTask{Script: script, Args: args, Stdin: stdin, Requirements: requirements}
+}
+
+// Validate 检查脚本内容
+func (t *PythonTask) Validate() error {
+	if strings.TrimSpace(t.Script) == "" {
+		return fmt.Errorf("脚本内容为空")
+	}
+	return nil
+}
+
+// Execute 执行脚本，脚本超时、内存超限或退出码不为0时在结果中返回失败原因
+func (t *PythonTask) Execute(ctx context.Context) (*Result, error) {
+	result, err := t.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("执行Python脚本失败: %v", err)
+	}
+	res := &Result{Data: result}
+	if failure := result.Failure(); failure != nil {
+		res.Failure = fmt.Errorf("Python脚本执行失败: %v", failure)
+	}
+	return res, nil
+}
+
+// Redacted 返回脚本的摘要
+func (t *PythonTask) Redacted() string {
+	return RedactScript(t.Script)
+}
+
+// Run 执行脚本，返回包含stdout、stderr和退出码的结果。ctx取消或到期时结束脚本进程
+func (t *PythonTask) Run(ctx context.Context) (*ScriptResult, error) {
+	if strings.TrimSpace(t.Script) == "" {
+		return nil, fmt.Errorf("脚本内容为空")
+	}
+
+	interpreter, err := preparePython(ctx, t.Requirements)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个任务使用独立的临时工作目录，执行结束后删除
+	dir, err := os.MkdirTemp(pythonOptions.WorkDir, "python-task-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时工作目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte(t.Script), 0600); err != nil {
+		return nil, fmt.Errorf("写入脚本文件失败: %v", err)
+	}
+
+	return runScript(ctx, scriptCommand{
+		Path:  interpreter,
+		Args:  append([]string{"main.py"}, t.Args...),
+		Dir:   dir,
+		Env:   scriptEnv(dir, pythonEnv...),
+		Stdin: t.Stdin,
+		Limits: scriptLimits{
+			Timeout:   pythonOptions.Timeout,
+			MaxMemory: uint64(pythonOptions.MaxMemoryMB) << 20,
+			MaxOutput: pythonOptions.MaxOutput,
+		},
+	})
+}
+
+// 运行Python时附加的环境变量：不生成.pyc、不缓冲输出、标准输入输出使用UTF-8
+var pythonEnv = []string{"PYTHONDONTWRITEBYTECODE=1", "PYTHONUNBUFFERED=1", "PYTHONIOENCODING=utf-8"}
+
+// preparePython 返回运行脚本使用的解释器。配置了虚拟环境时按需创建并安装缺少的依赖
+func preparePython(ctx context.Context, requirements []string) (string, error) {
+	binary := pythonOptions.Binary
+	if binary == "" {
+		binary = "python3"
+	}
+
+	for _, req := range requirements {
+		// 不允许通过依赖列表传入 -r、--index-url 等pip选项
+		if strings.TrimSpace(req) == "" || strings.HasPrefix(strings.TrimSpace(req), "-") {
+			return "", fmt.Errorf("无效的依赖: %q", req)
+		}
+	}
+
+	if pythonOptions.VenvDir == "" {
+		if len(requirements) > 0 {
+			return "", fmt.Errorf("未配置虚拟环境目录，不能安装依赖")
+		}
+		return binary, nil
+	}
+
+	// 命令都在临时工作目录中运行，虚拟环境目录需要使用绝对路径
+	venvDir, err := filepath.Abs(pythonOptions.VenvDir)
+	if err != nil {
+		return "", fmt.Errorf("获取虚拟环境目录绝对路径失败: %v", err)
+	}
+
+	venvMu.Lock()
+	defer venvMu.Unlock()
+
+	venvPython := venvInterpreter(venvDir)
+	if _, err := os.Stat(venvPython); err != nil {
+		if len(requirements) == 0 {
+			// 还没有创建过虚拟环境，直接使用系统解释器
+			return binary, nil
+		}
+		if err := runInstall(ctx, binary, "-m", "venv", venvDir); err != nil {
+			return "", fmt.Errorf("创建虚拟环境失败: %v", err)
+		}
+	}
+
+	installed := loadInstalledRequirements(venvDir)
+	var missing []string
+	for _, req := range requirements {
+		req = strings.TrimSpace(req)
+		if !installed[req] {
+			missing = append(missing, req)
+		}
+	}
+	if len(missing) > 0 {
+		args := append([]string{"-m", "pip", "install", "--disable-pip-version-check", "--no-input"}, missing...)
+		if err := runInstall(ctx, venvPython, args...); err != nil {
+			return "", fmt.Errorf("安装依赖失败: %v", err)
+		}
+		for _, req := range missing {
+			installed[req] = true
+		}
+		if err := saveInstalledRequirements(venvDir, installed); err != nil {
+			return "", err
+		}
+	}
+
+	return venvPython, nil
+}
+
+// runInstall 运行创建虚拟环境或安装依赖的命令，失败时返回命令的错误输出
+func runInstall(ctx context.Context, binary string, args ...string) error {
+	dir, err := os.MkdirTemp(pythonOptions.WorkDir, "python-install-")
+	if err != nil {
+		return fmt.Errorf("创建临时工作目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	result, err := runScript(ctx, scriptCommand{
+		Path: binary,
+		Args: args,
+		Dir:  dir,
+		Env:  scriptEnv(dir, pythonEnv...),
+		Limits: scriptLimits{
+			Timeout:   pythonOptions.InstallTimeout,
+			MaxOutput: pythonOptions.MaxOutput,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if failure := result.Failure(); failure != nil {
+		return fmt.Errorf("%v: %s", failure, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// venvInterpreter 返回虚拟环境中的Python解释器路径
+func venvInterpreter(venvDir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(venvDir, "Scripts", "python.exe")
+	}
+	return filepath.Join(venvDir, "bin", "python")
+}
+
+// loadInstalledRequirements 读取虚拟环境中已安装的依赖
+func loadInstalledRequirements(venvDir string) map[string]bool {
+	installed := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(venvDir, venvRequirementsFile))
+	if err != nil {
+		return installed
+	}
+	var list []string
+	if json.Unmarshal(data, &list) == nil {
+		for _, req := range list {
+			installed[req] = true
+		}
+	}
+	return installed
+}
+
+// saveInstalledRequirements 记录虚拟环境中已安装的依赖
+func saveInstalledRequirements(venvDir string, installed map[string]bool) error {
+	list := make([]string, 0, len(installed))
+	for req := range installed {
+		list = append(list, req)
+	}
+	sort.Strings(list)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(venvDir, venvRequirementsFile), data, 0644); err != nil {
+		return fmt.Errorf("保存已安装依赖列表失败: %v", err)
+	}
+	return nil
+}
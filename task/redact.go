@@ -0,0 +1,283 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// 名称中包含这些词的查询参数、表单字段、JSON键和请求头，它们的值在记录中隐藏
+var sensitiveName = regexp.MustCompile(`(?i)pass|pwd|token|secret|auth|cookie|session|key|sign|ticket|credential`)
+
+// 执行结果中值被隐藏的响应头和请求头，以及文本中"名称: 值"格式的行和JSON文本中这些名称的字段
+var (
+	credentialHeaders = []string{"set-cookie", "cookie", "authorization", "proxy-authorization"}
+	credentialLine    = regexp.MustCompile(`(?im)^(set-cookie|cookie|authorization|proxy-authorization)[ \t]*:[^\r\n]*`)
+	credentialField   = regexp.MustCompile(`(?i)("(?:set-cookie|cookie|authorization|proxy-authorization)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// 不需要加引号的shell参数
+var shellSafeArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// RedactCurlCommand 返回隐藏了凭据的curl命令，用于日志和执行记录：
+// -u 的密码、认证和cookie请求头、cookie字符串、URL中的密码，以及名称看起来是凭据的
+// 查询参数、表单字段和JSON字段的值。{{secret "名称"}} 等模板引用保持原样
+func RedactCurlCommand(cmd string) string {
+	parts, err := splitCurlCommand(strings.TrimSpace(cmd))
+	if err != nil {
+		return "curl " + secretMask
+	}
+
+	out := []string{parts[0]}
+	for i := 1; i < len(parts); i++ {
+		arg := parts[i]
+		if !strings.HasPrefix(arg, "-") {
+			out = append(out, redactCommandURL(arg))
+			continue
+		}
+
+		switch {
+		case curlArgOptions[arg] && i+1 < len(parts):
+			i++
+			out = append(out, arg, redactCurlOption(arg, parts[i]))
+		case len(arg) > 2 && arg[1] != '-' && curlArgOptions[arg[:2]]:
+			out = append(out, arg[:2]+redactCurlOption(arg[:2], arg[2:]))
+		default:
+			out = append(out, arg)
+		}
+	}
+	return shellJoin(out)
+}
+
+// RedactWorkflow 返回隐藏了凭据的工作流步骤，每个步骤一行，请求对象转换为等价的curl命令
+func RedactWorkflow(steps []WorkflowStep) string {
+	lines := make([]string, len(steps))
+	for i := range steps {
+		step := &steps[i]
+		command := step.Curl
+		if step.Request != nil {
+			command = "curl " + secretMask
+			if args, err := requestArgs(step.Request); err == nil {
+				command = shellJoin(append([]string{"curl"}, args...))
+			}
+		}
+		lines[i] = step.name(i) + ": " + RedactCurlCommand(command)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RedactScript 返回脚本的摘要。脚本中的凭据无法可靠识别，记录中只保存长度和SHA-256
+func RedactScript(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return fmt.Sprintf("<脚本 %d 字节 sha256:%s>", len(code), hex.EncodeToString(sum[:]))
+}
+
+// RedactResult 隐藏JSON格式的执行结果中的凭据，用于执行记录：名称为Set-Cookie、Cookie、
+// Authorization、Proxy-Authorization的字段（如响应头）的值，以及字符串中这些头所在的行（如 -i 的输出）
+// 和JSON文本中这些名称的字段（如回显请求头的响应体）
+func RedactResult(data json.RawMessage) (json.RawMessage, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactResultValue(value))
+}
+
+// redactResultValue 递归隐藏结果中的凭据
+func redactResultValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			if slices.Contains(credentialHeaders, strings.ToLower(name)) {
+				v[name] = maskResultValue(item)
+			} else {
+				v[name] = redactResultValue(item)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactResultValue(v[i])
+		}
+	case string:
+		v = credentialLine.ReplaceAllString(v, "${1}: "+secretMask)
+		return credentialField.ReplaceAllString(v, `${1}"`+secretMask+`"`)
+	}
+	return value
+}
+
+// maskResultValue 把凭据字段的值替换为占位符，多个值的头保留值的个数
+func maskResultValue(value interface{}) interface{} {
+	if values, ok := value.([]interface{}); ok {
+		for i := range values {
+			values[i] = secretMask
+		}
+		return values
+	}
+	return secretMask
+}
+
+// redactCurlOption 隐藏一个选项参数中的凭据
+func redactCurlOption(opt, value string) string {
+	switch opt {
+	case "-u", "--user", "-U", "--proxy-user":
+		if user, _, ok := strings.Cut(value, ":"); ok {
+			return user + ":" + maskValue(value[len(user)+1:])
+		}
+		return value
+	case "--oauth2-bearer", "--pass":
+		return maskValue(value)
+	case "-E", "--cert":
+		if file, _, ok := strings.Cut(value, ":"); ok {
+			return file + ":" + maskValue(value[len(file)+1:])
+		}
+		return value
+	case "--url", "-x", "--proxy", "-e", "--referer":
+		return redactCommandURL(value)
+	case "-H", "--header":
+		name, headerValue, ok := strings.Cut(value, ":")
+		if ok && sensitiveName.MatchString(name) {
+			return name + ": " + maskValue(strings.TrimSpace(headerValue))
+		}
+		return value
+	case "-b", "--cookie":
+		if !strings.Contains(value, "=") {
+			return value // cookie文件名
+		}
+		cookies := strings.Split(value, ";")
+		for i, c := range cookies {
+			if name, v, ok := strings.Cut(c, "="); ok {
+				cookies[i] = name + "=" + maskValue(v)
+			}
+		}
+		return strings.Join(cookies, ";")
+	case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+		return redactData(value)
+	case "-F", "--form", "--form-string":
+		name, v, ok := strings.Cut(value, "=")
+		if ok && sensitiveName.MatchString(name) && !strings.HasPrefix(v, "@") && !strings.HasPrefix(v, "<") {
+			return name + "=" + maskValue(v)
+		}
+		return value
+	}
+	return value
+}
+
+// redactCommandURL 隐藏命令中URL的密码和凭据类查询参数。直接修改原始字符串，
+// 不重新编码URL，路径中的模板引用等保持原样
+func redactCommandURL(raw string) string {
+	schemeEnd := strings.Index(raw, "://")
+	if schemeEnd == -1 {
+		return raw
+	}
+	rest := raw[schemeEnd+3:]
+	authorityEnd := strings.IndexAny(rest, "/?#")
+	if authorityEnd == -1 {
+		authorityEnd = len(rest)
+	}
+	authority, tail := rest[:authorityEnd], rest[authorityEnd:]
+
+	if at := strings.LastIndexByte(authority, '@'); at != -1 {
+		if user, _, ok := strings.Cut(authority[:at], ":"); ok {
+			authority = user + ":" + secretMask + authority[at:]
+		}
+	}
+
+	if q := strings.IndexByte(tail, '?'); q != -1 {
+		query, fragment := tail[q+1:], ""
+		if f := strings.IndexByte(query, '#'); f != -1 {
+			query, fragment = query[:f], query[f:]
+		}
+		tail = tail[:q+1] + redactPairs(query, "&") + fragment
+	}
+	return raw[:schemeEnd+3] + authority + tail
+}
+
+// redactData 隐藏请求体中的凭据：JSON对象按键判断，其余按表单格式处理
+func redactData(value string) string {
+	if strings.HasPrefix(value, "@") {
+		return value // 文件
+	}
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(trimmed), &doc); err == nil {
+			if data, err := json.Marshal(redactJSON(doc)); err == nil {
+				return string(data)
+			}
+		}
+	}
+	return redactPairs(value, "&")
+}
+
+// redactJSON 隐藏JSON中名称看起来是凭据的字段
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && sensitiveName.MatchString(key) {
+				v[key] = maskValue(s)
+			} else {
+				v[key] = redactJSON(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+
+// redactPairs 隐藏 name=value 列表中名称看起来是凭据的值
+func redactPairs(raw, sep string) string {
+	if raw == "" {
+		return raw
+	}
+	pairs := strings.Split(raw, sep)
+	for i, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if sensitiveName.MatchString(name) {
+			pairs[i] = pair[:strings.IndexByte(pair, '=')+1] + maskValue(value)
+		}
+	}
+	return strings.Join(pairs, sep)
+}
+
+// maskValue 把凭据替换为占位符，只引用密钥库或模板的值保持原样
+func maskValue(value string) string {
+	if value == "" {
+		return value
+	}
+	if strings.HasPrefix(value, "{{") && strings.HasSuffix(value, "}}") && strings.Count(value, "{{") == 1 {
+		return value
+	}
+	return secretMask
+}
+
+// shellJoin 把参数拼接为shell命令行，需要时用单引号包围
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafeArg.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,228 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ScriptResult 脚本任务（Node.js、Python、内置JavaScript引擎）的执行结果
+type ScriptResult struct {
+	ExitCode       int     `json:"exit_code"`
+	Stdout         string  `json:"stdout"`
+	Stderr         string  `json:"stderr"`
+	DurationMs     float64 `json:"duration_ms"`
+	TimedOut       bool    `json:"timed_out,omitempty"`
+	MemoryExceeded bool    `json:"memory_exceeded,omitempty"`
+	Cancelled      bool    `json:"cancelled,omitempty"` // 任务被取消或agent正在停止
+	Truncated      bool    `json:"truncated,omitempty"` // 输出超过上限被截断
+	// Result 内置JavaScript引擎任务中脚本最后一个表达式的值
+	Result interface{} `json:"result,omitempty"`
+}
+
+// Failure 返回脚本未正常完成的原因，正常退出时返回nil
+func (r *ScriptResult) Failure() error {
+	switch {
+	case r.Cancelled:
+		return fmt.Errorf("已取消")
+	case r.TimedOut:
+		return fmt.Errorf("执行超时")
+	case r.MemoryExceeded:
+		return fmt.Errorf("内存超过限制")
+	case r.ExitCode != 0:
+		return fmt.Errorf("退出码 %d", r.ExitCode)
+	}
+	return nil
+}
+
+// scriptLimits 脚本进程的资源限制
+type scriptLimits struct {
+	Timeout   time.Duration
+	MaxMemory uint64 // 常驻内存上限（字节），0表示不限制
+	MaxOutput int    // stdout、stderr各自的最大字节数，0表示不限制
+}
+
+// 检查进程内存占用的间隔
+const memoryCheckInterval = 200 * time.Millisecond
+
+// 进程退出后等待输出管道关闭的最长时间，避免后台子进程持有管道导致一直等待
+const pipeWaitDelay = time.Second
+
+// scriptCommand 描述一次脚本进程的运行
+type scriptCommand struct {
+	Path   string
+	Args   []string
+	Dir    string
+	Env    []string
+	Stdin  string
+	Limits scriptLimits
+}
+
+// runScript 在独立的进程组中运行脚本，超时、内存超限或ctx取消时结束整个进程组。
+// Linux上脚本正常退出后同样结束其残留的后台进程
+func runScript(ctx context.Context, sc scriptCommand) (*ScriptResult, error) {
+	cmd := exec.Command(sc.Path, sc.Args...)
+	cmd.Dir = sc.Dir
+	cmd.Env = sc.Env
+	cmd.Stdin = strings.NewReader(sc.Stdin)
+	stdout := &limitedBuffer{limit: sc.Limits.MaxOutput}
+	stderr := &limitedBuffer{limit: sc.Limits.MaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = pipeWaitDelay
+	setProcessGroup(cmd)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动进程失败: %v", err)
+	}
+
+	group := &processGroup{cmd: cmd}
+	done := make(chan error, 1)
+	go func() {
+		// 支持的平台上先等待进程退出但不回收，在回收前清理进程组中残留的后台进程
+		if waitExited(cmd) {
+			group.killBeforeReap()
+		}
+		done <- cmd.Wait()
+	}()
+
+	result := &ScriptResult{}
+	var timeout <-chan time.Time
+	if sc.Limits.Timeout > 0 {
+		timer := time.NewTimer(sc.Limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var memoryCheck <-chan time.Time
+	var proc *process.Process
+	if sc.Limits.MaxMemory > 0 {
+		if p, err := process.NewProcess(int32(cmd.Process.Pid)); err == nil {
+			proc = p
+			ticker := time.NewTicker(memoryCheckInterval)
+			defer ticker.Stop()
+			memoryCheck = ticker.C
+		}
+	}
+
+	var waitErr error
+wait:
+	for {
+		select {
+		case waitErr = <-done:
+			break wait
+		case <-timeout:
+			result.TimedOut = true
+			group.kill()
+			waitErr = <-done
+			break wait
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				result.TimedOut = true
+			} else {
+				result.Cancelled = true
+			}
+			group.kill()
+			waitErr = <-done
+			break wait
+		case <-memoryCheck:
+			info, err := proc.MemoryInfo()
+			if err == nil && info.RSS > sc.Limits.MaxMemory {
+				result.MemoryExceeded = true
+				group.kill()
+				waitErr = <-done
+				break wait
+			}
+		}
+	}
+
+	result.DurationMs = roundMillis(time.Since(start))
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+
+	if waitErr != nil {
+		if _, ok := waitErr.(*exec.ExitError); !ok && waitErr != exec.ErrWaitDelay {
+			return nil, fmt.Errorf("等待进程结束失败: %v", waitErr)
+		}
+	}
+	result.ExitCode = cmd.ProcessState.ExitCode()
+	return result, nil
+}
+
+// processGroup 结束脚本的进程组。进程组长被回收后进程组ID可能被其他进程复用，
+// 因此只在回收前发送信号
+type processGroup struct {
+	cmd    *exec.Cmd
+	mu     sync.Mutex
+	reaped bool // 进程组已经结束，即将回收组长
+}
+
+// kill 超时、内存超限或取消时结束进程组
+func (g *processGroup) kill() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.reaped {
+		killProcessGroup(g.cmd)
+	}
+}
+
+// killBeforeReap 在组长已退出、尚未回收时结束进程组中的其他进程，之后不再发送信号
+func (g *processGroup) killBeforeReap() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	killProcessGroup(g.cmd)
+	g.reaped = true
+}
+
+// limitedBuffer 只保留前limit个字节的输出，超出部分丢弃
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if b.limit > 0 {
+		if remain := b.limit - b.buf.Len(); len(p) > remain {
+			p = p[:remain]
+			b.truncated = true
+		}
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// scriptEnv 返回脚本进程的环境变量。不继承agent的环境，只保留运行解释器必需的变量，
+// 并将HOME和临时目录指向任务的工作目录
+func scriptEnv(dir string, extra ...string) []string {
+	var env []string
+	for _, key := range []string{"PATH", "SystemRoot", "LANG", "TZ"} {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	for _, key := range []string{"HOME", "USERPROFILE", "TMPDIR", "TMP", "TEMP"} {
+		env = append(env, key+"="+dir)
+	}
+	return append(env, extra...)
+}
@@ -0,0 +1,20 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitExited 等待进程退出但不回收（WNOWAIT），退出的进程保留到cmd.Wait回收为止，
+// 其PID和进程组ID在此之前不会被复用
+func waitExited(cmd *exec.Cmd) bool {
+	var info unix.Siginfo
+	for {
+		err := unix.Waitid(unix.P_PID, cmd.Process.Pid, &info, unix.WEXITED|unix.WNOWAIT, nil)
+		if err != unix.EINTR {
+			return err == nil
+		}
+	}
+}
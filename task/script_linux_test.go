@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitGone 等待进程结束（不存在或已成为僵尸进程）
+func waitGone(t *testing.T, pid int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil {
+			return
+		}
+		// 第三个字段为进程状态，命令名在括号中
+		if fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:])); len(fields) > 0 && fields[0] == "Z" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("后台进程 %d 没有被结束", pid)
+}
+
+// backgroundPID 返回脚本输出的后台进程PID
+func backgroundPID(t *testing.T, result *ScriptResult) int {
+	t.Helper()
+	pid, err := strconv.Atoi(strings.TrimSpace(result.Stdout))
+	if err != nil {
+		t.Fatalf("无法解析后台进程的PID: %q", result.Stdout)
+	}
+	return pid
+}
+
+// 脚本正常退出后结束它留下的后台进程，不需要等待输出管道的超时
+func TestRunScriptKillsBackgroundOnExit(t *testing.T) {
+	result, err := runScript(context.Background(), scriptCommand{
+		Path: "/bin/sh",
+		Args: []string{"-c", "sleep 30 & echo $!"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || result.TimedOut || result.Cancelled {
+		t.Errorf("脚本结果: %+v", result)
+	}
+	if result.DurationMs >= float64(pipeWaitDelay/time.Millisecond) {
+		t.Errorf("等待了输出管道的超时: %.0fms", result.DurationMs)
+	}
+	waitGone(t, backgroundPID(t, result))
+}
+
+func TestRunScriptTimeoutKillsGroup(t *testing.T) {
+	result, err := runScript(context.Background(), scriptCommand{
+		Path:   "/bin/sh",
+		Args:   []string{"-c", "sleep 30 & echo $!; sleep 30"},
+		Limits: scriptLimits{Timeout: 200 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut {
+		t.Errorf("脚本结果: %+v", result)
+	}
+	waitGone(t, backgroundPID(t, result))
+}
+
+func TestRunScriptCancelKillsGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	result, err := runScript(ctx, scriptCommand{
+		Path: "/bin/sh",
+		Args: []string{"-c", "sleep 30 & echo $!; wait"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Cancelled {
+		t.Errorf("脚本结果: %+v", result)
+	}
+	waitGone(t, backgroundPID(t, result))
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+// Package task 提供任务执行相关功能
+package task
+
+import "os/exec"
+
+// waitExited 不支持在回收前等待进程退出，进程正常退出后不再结束其进程组
+func waitExited(cmd *exec.Cmd) bool {
+	return false
+}
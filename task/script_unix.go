@@ -0,0 +1,22 @@
+//go:build !windows
+
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让脚本进程成为新进程组的组长，便于结束它创建的所有子进程
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup 结束脚本进程所在的整个进程组
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
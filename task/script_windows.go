@@ -0,0 +1,27 @@
+//go:build windows
+
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup 在新的进程组中启动脚本进程
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// killProcessGroup 通过taskkill结束脚本进程及其所有子进程。
+// 进程已退出时PID可能被其他进程复用，因此不再处理
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil || cmd.ProcessState != nil {
+		return
+	}
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if kill.Run() != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,89 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SecretStore 保存在agent上的密钥，任务中通过 {{secret "名称"}} 引用，
+// 控制端只需要发送名称，密钥的值不会出现在任务请求中
+type SecretStore interface {
+	Get(name string) (string, error)
+}
+
+// 当前使用的密钥库
+var secretStore SecretStore
+
+// SetSecretStore 设置 {{secret "名称"}} 读取密钥的密钥库
+func SetSecretStore(store SecretStore) {
+	secretStore = store
+}
+
+// lookupSecret 读取密钥，并把它的值和URL编码后的值记录到resolved中，
+// 用于在结果和错误信息中隐藏
+func lookupSecret(name string, resolved *[]string) (string, error) {
+	if secretStore == nil {
+		return "", fmt.Errorf("agent未配置密钥库")
+	}
+	value, err := secretStore.Get(name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != nil {
+		*resolved = append(*resolved, value)
+		if escaped := url.QueryEscape(value); escaped != value {
+			*resolved = append(*resolved, escaped)
+		}
+	}
+	return value, nil
+}
+
+// maskText 将文本中出现的凭据替换为占位符。先替换较长的凭据，
+// 避免一个凭据是另一个的前缀时留下未替换的部分
+func maskText(s string, secrets []string) string {
+	if len(secrets) == 0 {
+		return s
+	}
+	sorted := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != "" {
+			sorted = append(sorted, secret)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, secret := range sorted {
+		s = strings.ReplaceAll(s, secret, secretMask)
+	}
+	return s
+}
+
+// maskError 隐藏错误信息中的凭据，没有需要隐藏的内容时返回原来的错误
+func maskError(err error, secrets []string) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+	masked := maskText(err.Error(), secrets)
+	if masked == err.Error() {
+		return err
+	}
+	return errors.New(masked)
+}
+
+// maskResult 隐藏结果中出现的凭据，服务器在响应中回显了密码或密钥时也不会返回给控制端
+func maskResult(result *CurlResult, secrets []string) {
+	if result == nil || len(secrets) == 0 {
+		return
+	}
+	result.URL = maskText(result.URL, secrets)
+	result.Body = maskText(result.Body, secrets)
+	result.Output = maskText(result.Output, secrets)
+	for _, values := range result.Headers {
+		for i := range values {
+			values[i] = maskText(values[i], secrets)
+		}
+	}
+}
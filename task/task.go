@@ -1,7 +1,144 @@
 // Package task 提供任务执行相关功能
 package task
 
-// Task 任务接口
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Task 一个待执行的任务，由任务类型从请求体解析得到
 type Task interface {
-	Execute() (string, error)
+	// Validate 在执行前检查参数，提交异步任务和注册定时任务时也会调用
+	Validate() error
+	// Execute 执行任务。参数无效或任务无法执行时返回错误；任务执行了但没有成功
+	// （如断言不满足、脚本退出码不为0）时在结果的Failure中说明
+	Execute(ctx context.Context) (*Result, error)
+	// Redacted 返回隐藏了凭据的任务内容，用于执行记录和定时任务列表
+	Redacted() string
+}
+
+// HostTask 请求固定主机的任务可以实现的接口，批量执行时按主机限制并发
+type HostTask interface {
+	// Hosts 返回任务会请求的主机名（小写，不含端口），无法确定时不返回
+	Hosts() []string
+}
+
+// Result 任务的执行结果
+type Result struct {
+	// Data 任务类型的结构化结果，格式见注册时的Result
+	Data interface{}
+	// Outcome 按断言得到的结果分类，没有断言的任务类型为nil
+	Outcome *Outcome
+	// Failure 任务执行了但没有成功的原因
+	Failure error
+}
+
+// Type 一种任务类型
+type Type struct {
+	// Name 任务类型名称，如 curl
+	Name string `json:"name"`
+	// Aliases 兼容旧版本控制端的数字类型，如 "1"
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"description"`
+	// Params 任务参数的JSON Schema，由New返回的结构体生成。参数与type、tags一起放在请求体的顶层
+	Params map[string]interface{} `json:"params"`
+	// Result 执行结果中data的JSON Schema，由ResultType生成
+	Result map[string]interface{} `json:"result"`
+
+	// New 返回参数为零值的任务，请求体解析到它上面
+	New func() Task `json:"-"`
+	// ResultType 结构化结果的零值，如 &CurlResult{}
+	ResultType interface{} `json:"-"`
+}
+
+// Parse 从请求体解析任务参数
+func (t *Type) Parse(params json.RawMessage) (Task, error) {
+	task := t.New()
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, task); err != nil {
+			return nil, fmt.Errorf("无法解析任务参数: %v", err)
+		}
+	}
+	return task, nil
+}
+
+var (
+	registryMu sync.RWMutex
+	// registry 按名称和别名索引的任务类型，types 按注册顺序排列
+	registry = make(map[string]*Type)
+	types    []*Type
+)
+
+// Register 注册任务类型，名称或别名重复时panic
+func Register(t Type) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	t.Params = jsonSchema(reflect.TypeOf(t.New()))
+	t.Result = jsonSchema(reflect.TypeOf(t.ResultType))
+	registered := &t
+	for _, name := range append([]string{t.Name}, t.Aliases...) {
+		if _, ok := registry[name]; ok {
+			panic(fmt.Sprintf("任务类型 %s 重复注册", name))
+		}
+		registry[name] = registered
+	}
+	types = append(types, registered)
+}
+
+// Lookup 按名称或数字别名查找任务类型
+func Lookup(name string) (*Type, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	t, ok := registry[name]
+	return t, ok
+}
+
+// Types 返回所有任务类型，按注册顺序排列
+func Types() []*Type {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]*Type(nil), types...)
+}
+
+// 内置的任务类型，数字别名与旧版本控制端使用的类型一致
+func init() {
+	Register(Type{
+		Name:        "curl",
+		Aliases:     []string{"1"},
+		Description: "执行curl命令，按断言判断结果",
+		New:         func() Task { return &CurlTask{} },
+		ResultType:  &CurlResult{},
+	})
+	Register(Type{
+		Name:        "node",
+		Aliases:     []string{"2"},
+		Description: "使用Node.js执行脚本",
+		New:         func() Task { return &NodeTask{} },
+		ResultType:  &ScriptResult{},
+	})
+	Register(Type{
+		Name:        "python",
+		Aliases:     []string{"3"},
+		Description: "使用Python执行脚本，可以安装依赖",
+		New:         func() Task { return &PythonTask{} },
+		ResultType:  &ScriptResult{},
+	})
+	Register(Type{
+		Name:        "js",
+		Aliases:     []string{"4"},
+		Description: "在内置的JavaScript引擎中执行脚本，不依赖Node.js",
+		New:         func() Task { return &JSTask{} },
+		ResultType:  &ScriptResult{},
+	})
+	Register(Type{
+		Name:        "workflow",
+		Aliases:     []string{"5"},
+		Description: "按顺序执行多个HTTP请求，步骤之间传递变量和cookie",
+		New:         func() Task { return &WorkflowTask{} },
+		ResultType:  &WorkflowResult{},
+	})
 }
@@ -0,0 +1,242 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	// 内置时区数据，Windows等没有系统时区数据库的环境也能使用 date 函数的时区参数
+	_ "time/tzdata"
+)
+
+// 变量名必须是合法的标识符，才能在模板中以 {{name}} 的形式引用
+var templateVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 模板语法的关键字不能作为变量名
+var templateKeywords = map[string]bool{
+	"if": true, "else": true, "end": true, "range": true, "with": true, "define": true, "template": true,
+	"block": true, "break": true, "continue": true, "nil": true, "true": true, "false": true,
+}
+
+// rand_hex 允许生成的最大长度
+const maxRandHexLength = 1024
+
+// 多个字符串合并为一个模板渲染时使用的分隔符
+const templateSeparator = "\x00"
+
+// templateVars 模板中可以引用的变量
+type templateVars map[string]string
+
+// validVarName 检查变量名是否可以在模板中引用
+func validVarName(name string) error {
+	if !templateVarName.MatchString(name) {
+		return fmt.Errorf("变量名只能包含字母、数字和下划线，且不能以数字开头: %q", name)
+	}
+	if templateKeywords[name] {
+		return fmt.Errorf("变量名不能使用模板关键字: %s", name)
+	}
+	if _, ok := templateFuncs(time.Time{}, nil)[name]; ok {
+		return fmt.Errorf("变量名不能与模板函数重名: %s", name)
+	}
+	return nil
+}
+
+// templateFuncs 返回模板函数。一次渲染中的时间函数都基于同一个now，
+// 例如时间戳和用它计算的签名中的时间保持一致；读取的密钥记录到resolved中
+func templateFuncs(now time.Time, resolved *[]string) template.FuncMap {
+	return template.FuncMap{
+		"now_unix": func() string { return strconv.FormatInt(now.Unix(), 10) },
+		"now_ms":   func() string { return strconv.FormatInt(now.UnixMilli(), 10) },
+		"date": func(layout string, tz ...string) (string, error) {
+			t := now
+			if len(tz) > 0 && tz[0] != "" {
+				loc, err := time.LoadLocation(tz[0])
+				if err != nil {
+					return "", fmt.Errorf("无效的时区: %s", tz[0])
+				}
+				t = t.In(loc)
+			}
+			return t.Format(layout), nil
+		},
+		"uuid":        newUUID,
+		"rand_hex":    randHex,
+		"md5":         hashHex(md5.New),
+		"sha1":        hashHex(sha1.New),
+		"sha256":      hashHex(sha256.New),
+		"hmac_sha256": hmacSHA256,
+		"base64": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"urlencode": url.QueryEscape,
+		// totp "名称" 生成agent上配置的TOTP密钥的当前口令
+		"totp": func(name string) (string, error) { return totpCode(name, now) },
+		// secret "名称" 读取agent密钥库中的密钥
+		"secret": func(name string) (string, error) { return lookupSecret(name, resolved) },
+	}
+}
+
+// hashHex 返回计算摘要并输出十六进制的模板函数
+func hashHex(newHash func() hash.Hash) func(string) string {
+	return func(s string) string {
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+func hmacSHA256(key, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newUUID 生成随机的UUID（版本4）
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randHex 生成n个随机的十六进制字符
+func randHex(n int) (string, error) {
+	if n <= 0 || n > maxRandHexLength {
+		return "", fmt.Errorf("rand_hex的长度必须在1到%d之间", maxRandHexLength)
+	}
+	b := make([]byte, (n+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b)[:n], nil
+}
+
+// render 渲染文本中的模板，引用未定义的变量或函数时返回错误。
+// 每个变量注册为同名的无参函数，因此 {{name}} 直接输出变量的值。
+// 模板中读取的密钥追加到resolved，调用方需要在结果和错误信息中隐藏它们
+func (v templateVars) render(text string, resolved *[]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	funcs := templateFuncs(time.Now(), resolved)
+	for name, value := range v {
+		value := value
+		funcs[name] = func() string { return value }
+	}
+
+	tmpl, err := template.New("").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析模板失败: %v", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, nil); err != nil {
+		return "", fmt.Errorf("渲染模板失败: %v", err)
+	}
+	return sb.String(), nil
+}
+
+// renderAll 在一次渲染中处理字符串列表，所有字符串使用相同的时间，
+// 前面用 {{$n := rand_hex 16}} 定义的模板变量在后面的字符串中也可以使用
+func (v templateVars) renderAll(texts []string, resolved *[]string) ([]string, error) {
+	joined := strings.Join(texts, templateSeparator)
+	if !strings.Contains(joined, "{{") {
+		return texts, nil
+	}
+	if strings.Count(joined, templateSeparator) != len(texts)-1 {
+		return nil, fmt.Errorf("参数中不能包含NUL字符")
+	}
+
+	rendered, err := v.render(joined, resolved)
+	if err != nil {
+		return nil, err
+	}
+	out := strings.Split(rendered, templateSeparator)
+	if len(out) != len(texts) {
+		return nil, fmt.Errorf("模板输出中不能包含NUL字符")
+	}
+	return out, nil
+}
+
+// renderValue 渲染JSON值中的所有字符串（包括对象的键），所有字符串在一次渲染中完成，
+// 对象按键的字母顺序处理
+func (v templateVars) renderValue(value interface{}, resolved *[]string) (interface{}, error) {
+	var texts []string
+	collectStrings(value, &texts)
+	rendered, err := v.renderAll(texts, resolved)
+	if err != nil {
+		return nil, err
+	}
+	return replaceStrings(value, &rendered), nil
+}
+
+// collectStrings 按固定顺序收集JSON值中的字符串
+func collectStrings(value interface{}, texts *[]string) {
+	switch val := value.(type) {
+	case string:
+		*texts = append(*texts, val)
+	case []interface{}:
+		for _, item := range val {
+			collectStrings(item, texts)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			*texts = append(*texts, key)
+			collectStrings(val[key], texts)
+		}
+	}
+}
+
+// replaceStrings 按collectStrings的顺序用渲染结果替换JSON值中的字符串
+func replaceStrings(value interface{}, rendered *[]string) interface{} {
+	next := func() string {
+		s := (*rendered)[0]
+		*rendered = (*rendered)[1:]
+		return s
+	}
+
+	switch val := value.(type) {
+	case string:
+		return next()
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = replaceStrings(item, rendered)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := make(map[string]interface{}, len(val))
+		for _, key := range keys {
+			renderedKey := next()
+			out[renderedKey] = replaceStrings(val[key], rendered)
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package task
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderAllKeepsArguments(t *testing.T) {
+	vars := templateVars{"user": `a b "c"`, "empty": ""}
+	tests := []struct {
+		name  string
+		texts []string
+		want  []string
+	}{
+		{"没有模板", []string{"-d", "a=1", ""}, []string{"-d", "a=1", ""}},
+		// 变量的值包含空格和引号也不会改变参数的划分
+		{"变量", []string{"-d", "user={{user}}", "{{empty}}", "x"}, []string{"-d", `user=a b "c"`, "", "x"}},
+		{"前面定义的模板变量", []string{"{{$n := print \"ab\" \"cd\"}}n={{$n}}", "sign={{md5 $n}}"}, []string{"n=abcd", "sign=e2fc714c4727ee9395f324cd2e7f331f"}},
+		{"跨参数的动作", []string{"{{if true}}a", "b{{end}}"}, []string{"a", "b"}},
+		{"字面的{{", []string{`{{"{{"}}name}}`}, []string{"{{name}}"}},
+		{"单个参数", []string{"{{base64 \"a\"}}"}, []string{"YQ=="}},
+	}
+	for _, tt := range tests {
+		got, err := vars.renderAll(tt.texts, nil)
+		if err != nil {
+			t.Errorf("%s 返回错误: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 得到 %q, 期望 %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderAllSameTime(t *testing.T) {
+	got, err := templateVars(nil).renderAll([]string{"{{now_ms}}", "x", "{{now_ms}}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != got[2] {
+		t.Errorf("同一次渲染中的时间不同: %q", got)
+	}
+}
+
+func TestRenderAllNUL(t *testing.T) {
+	tests := []struct {
+		name  string
+		vars  templateVars
+		texts []string
+		err   string // 期望的错误，空字符串表示不应出错
+	}{
+		// 没有模板时按原样返回，不检查NUL
+		{"没有模板的NUL", nil, []string{"a\x00b", "c"}, ""},
+		{"参数中的NUL", nil, []string{"a\x00b", "{{now_unix}}"}, "参数中不能包含NUL字符"},
+		{"变量值中的NUL", templateVars{"v": "a\x00b"}, []string{"{{v}}", "c"}, "模板输出中不能包含NUL字符"},
+		{"函数输出的NUL", nil, []string{`{{"\x00"}}`}, "模板输出中不能包含NUL字符"},
+		{"未定义的变量", nil, []string{"{{missing}}"}, "解析模板失败"},
+	}
+	for _, tt := range tests {
+		got, err := tt.vars.renderAll(tt.texts, nil)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s 返回错误: %v", tt.name, err)
+		case tt.err == "" && !slices.Equal(got, tt.texts):
+			t.Errorf("%s: 得到 %q", tt.name, got)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: 错误为 %v, 期望 %s", tt.name, err, tt.err)
+		}
+	}
+}
+
+// curl任务默认按原样发送 {{，template为true时计算模板
+func TestCurlTaskTemplateOptIn(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		template bool
+		data     string
+		want     string
+	}{
+		{"默认不计算模板", false, "<p>{{name}}</p>", "<p>{{name}}</p>"},
+		{"不完整的模板", false, "{{#items}}{{/items}", "{{#items}}{{/items}"},
+		{"计算模板", true, `sign={{md5 "abcd"}}`, "sign=e2fc714c4727ee9395f324cd2e7f331f"},
+	}
+	for _, tt := range tests {
+		body = ""
+		task := &CurlTask{Command: "curl " + srv.URL + " --data-raw '" + tt.data + "'", Template: tt.template}
+		if _, err := task.Execute(context.Background()); err != nil {
+			t.Errorf("%s 返回错误: %v", tt.name, err)
+			continue
+		}
+		if body != tt.want {
+			t.Errorf("%s: 请求体为 %q, 期望 %q", tt.name, body, tt.want)
+		}
+	}
+
+	task := &CurlTask{Command: "curl " + srv.URL + " -d '{{name}}'", Template: true}
+	if _, err := task.Execute(context.Background()); err == nil || !strings.Contains(err.Error(), "解析模板失败") {
+		t.Errorf("计算模板时引用未定义的变量应返回错误, 得到 %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTP口令的默认参数，与Google Authenticator等应用一致
+const (
+	defaultTOTPDigits = 6
+	defaultTOTPPeriod = 30 * time.Second
+)
+
+// TOTPOptions 一个命名的TOTP动态口令。密钥保存在agent的密钥库中，任务中通过名称引用
+type TOTPOptions struct {
+	// SecretName 密钥库中保存密钥的名称，为空时与TOTP的名称相同。密钥为base32编码，
+	// 也可以是 otpauth://totp/... 格式的URI（绑定二维码中的内容）
+	SecretName string
+	// Digits 口令位数，为0时使用URI中的值或默认的6位
+	Digits int
+	// Period 口令的有效时间，为0时使用URI中的值或默认的30秒
+	Period time.Duration
+	// Algorithm 摘要算法SHA1、SHA256或SHA512，为空时使用URI中的值或默认的SHA1
+	Algorithm string
+}
+
+// 当前配置的TOTP口令参数，按名称索引
+var totpSecrets map[string]TOTPOptions
+
+// SetTOTPSecrets 设置可以在任务中按名称引用的TOTP口令参数
+func SetTOTPSecrets(secrets map[string]TOTPOptions) {
+	totpSecrets = secrets
+}
+
+// TOTP支持的摘要算法
+var totpAlgorithms = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+// totpParams 解析后的TOTP参数
+type totpParams struct {
+	key     []byte
+	digits  int
+	period  time.Duration
+	newHash func() hash.Hash
+}
+
+// totpCode 生成名为name的TOTP在t时刻的口令。密钥从密钥库读取，没有配置参数时使用默认参数
+func totpCode(name string, t time.Time) (string, error) {
+	opts := totpSecrets[name]
+	secretName := opts.SecretName
+	if secretName == "" {
+		secretName = name
+	}
+	secret, err := lookupSecret(secretName, nil)
+	if err != nil {
+		return "", fmt.Errorf("读取TOTP密钥 %s 失败: %v", name, err)
+	}
+	params, err := opts.params(secret)
+	if err != nil {
+		return "", fmt.Errorf("TOTP密钥 %s 无效: %v", name, err)
+	}
+	return params.generate(t), nil
+}
+
+// params 合并密钥URI中的参数、配置的参数和默认值。错误信息中不包含密钥
+func (o TOTPOptions) params(secret string) (*totpParams, error) {
+	secret = strings.TrimSpace(secret)
+	digits, period, algorithm := 0, time.Duration(0), ""
+
+	if strings.HasPrefix(secret, "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil || u.Host != "totp" {
+			return nil, fmt.Errorf("不是有效的otpauth://totp URI")
+		}
+		query := u.Query()
+		secret = query.Get("secret")
+		if v := query.Get("digits"); v != "" {
+			if digits, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("URI中的digits无效")
+			}
+		}
+		if v := query.Get("period"); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("URI中的period无效")
+			}
+			period = time.Duration(seconds) * time.Second
+		}
+		algorithm = query.Get("algorithm")
+	}
+
+	if o.Digits != 0 {
+		digits = o.Digits
+	}
+	if o.Period != 0 {
+		period = o.Period
+	}
+	if o.Algorithm != "" {
+		algorithm = o.Algorithm
+	}
+	if digits == 0 {
+		digits = defaultTOTPDigits
+	}
+	if period == 0 {
+		period = defaultTOTPPeriod
+	}
+	if algorithm == "" {
+		algorithm = "SHA1"
+	}
+
+	if digits < 6 || digits > 10 {
+		return nil, fmt.Errorf("口令位数必须在6到10之间")
+	}
+	if period < time.Second {
+		return nil, fmt.Errorf("有效时间不能小于1秒")
+	}
+	newHash, ok := totpAlgorithms[strings.ToUpper(strings.ReplaceAll(algorithm, "-", ""))]
+	if !ok {
+		return nil, fmt.Errorf("不支持的摘要算法: %s", algorithm)
+	}
+
+	// 密钥通常按4个字符一组显示，并可能省略末尾的填充
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("密钥不是有效的base32编码")
+	}
+
+	return &totpParams{key: key, digits: digits, period: period, newHash: newHash}, nil
+}
+
+// generate 按RFC 6238计算t所在时间窗口的口令
+func (p *totpParams) generate(t time.Time) string {
+	counter := uint64(t.Unix() / int64(p.period/time.Second))
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(p.newHash, p.key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// RFC 4226的动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	code := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	mod := uint64(1)
+	for i := 0; i < p.digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", p.digits, code%mod)
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mapSecretStore 测试用的内存密钥库
+type mapSecretStore map[string]string
+
+func (m mapSecretStore) Get(name string) (string, error) {
+	value, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("密钥不存在: %s", name)
+	}
+	return value, nil
+}
+
+// useTOTP 设置测试用的密钥库和TOTP参数，测试结束后恢复
+func useTOTP(t *testing.T, store SecretStore, secrets map[string]TOTPOptions) {
+	t.Helper()
+	oldStore, oldSecrets := secretStore, totpSecrets
+	SetSecretStore(store)
+	SetTOTPSecrets(secrets)
+	t.Cleanup(func() {
+		SetSecretStore(oldStore)
+		SetTOTPSecrets(oldSecrets)
+	})
+}
+
+// RFC 6238 附录B的测试向量，8位口令、30秒有效时间
+func TestTOTPRFC6238(t *testing.T) {
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vectors := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1111111111, map[string]string{"SHA1": "14050471", "SHA256": "67062674", "SHA512": "99943326"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{2000000000, map[string]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+
+	store := mapSecretStore{}
+	secrets := map[string]TOTPOptions{}
+	for algorithm, seed := range seeds {
+		name := "rfc_" + strings.ToLower(algorithm)
+		store[name] = base32.StdEncoding.EncodeToString([]byte(seed))
+		secrets[name] = TOTPOptions{Digits: 8, Algorithm: algorithm}
+	}
+	useTOTP(t, store, secrets)
+
+	for _, v := range vectors {
+		for algorithm, want := range v.want {
+			got, err := totpCode("rfc_"+strings.ToLower(algorithm), time.Unix(v.unix, 0))
+			if err != nil {
+				t.Fatalf("%s T=%d 返回错误: %v", algorithm, v.unix, err)
+			}
+			if got != want {
+				t.Errorf("%s T=%d 得到 %s, 期望 %s", algorithm, v.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestTOTPSecretFromVault(t *testing.T) {
+	seed := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	useTOTP(t, mapSecretStore{
+		// 密钥名称默认与TOTP名称相同；密钥可以带空格、小写、省略填充
+		"acct1":      strings.ToLower(seed[:4] + " " + seed[4:]),
+		"acct2_totp": "otpauth://totp/Example:bob?secret=" + seed + "&digits=8&algorithm=SHA1&period=30",
+		"acct3":      "otpauth://totp/Example:bob?secret=" + seed + "&digits=8",
+	}, map[string]TOTPOptions{
+		"acct2": {SecretName: "acct2_totp"},
+		// 配置的参数覆盖URI中的同名参数
+		"acct3": {Digits: 6},
+	})
+
+	now := time.Unix(59, 0)
+	tests := []struct{ name, want string }{
+		{"acct1", "287082"},
+		{"acct2", "94287082"},
+		{"acct3", "287082"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(tt.name, now)
+		if err != nil {
+			t.Errorf("%s 返回错误: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s 得到 %s, 期望 %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := totpCode("missing", now); err == nil {
+		t.Error("密钥库中没有的TOTP应返回错误")
+	}
+}
+
+func TestTOTPInvalidParams(t *testing.T) {
+	seed := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		name   string
+		opts   TOTPOptions
+		secret string
+	}{
+		{"非base32密钥", TOTPOptions{}, "not base32!"},
+		{"空密钥", TOTPOptions{}, ""},
+		{"位数过少", TOTPOptions{Digits: 5}, seed},
+		{"位数过多", TOTPOptions{Digits: 11}, seed},
+		{"有效时间过短", TOTPOptions{Period: time.Millisecond}, seed},
+		{"不支持的算法", TOTPOptions{Algorithm: "MD5"}, seed},
+		{"不是TOTP的URI", TOTPOptions{}, "otpauth://hotp/x?secret=" + seed},
+		{"URI中的位数无效", TOTPOptions{}, "otpauth://totp/x?secret=" + seed + "&digits=x"},
+	}
+	for _, tt := range tests {
+		_, err := tt.opts.params(tt.secret)
+		if err == nil {
+			t.Errorf("%s: 应返回错误", tt.name)
+			continue
+		}
+		if tt.secret != "" && strings.Contains(err.Error(), seed) {
+			t.Errorf("%s: 错误信息中包含密钥: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Package task 提供任务执行相关功能
+package task
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 一个工作流最多包含的步骤数
+const maxWorkflowSteps = 50
+
+// WorkflowStep 工作流中的一个请求步骤，Curl和Request二选一。
+// 命令和请求对象中的 {{变量名}} 在执行前替换为之前提取或传入的变量
+type WorkflowStep struct {
+	Name string `json:"name,omitempty"`
+	// Curl curl命令，变量在拆分参数后替换，变量的值中包含引号、空格也不会改变参数的划分
+	Curl string `json:"curl,omitempty"`
+	// Request 请求对象，格式与JavaScript任务的 http.request 相同：
+	// {url, method, headers, body, timeout, follow, insecure, options}
+	Request map[string]interface{} `json:"request,omitempty"`
+	// Extract 从响应中提取变量供后续步骤使用，只在步骤成功时提取
+	Extract []Extraction `json:"extract,omitempty"`
+	// Expectation 判定步骤结果的断言，失败或已完成时工作流终止
+	Expectation
+}
+
+// Extraction 从响应中提取一个变量，JSON、Regex、Header、Cookie四选一
+type Extraction struct {
+	Var string `json:"var"`
+	// JSON 响应体中的JSONPath，如 $.data.token
+	JSON string `json:"json,omitempty"`
+	// Regex 在响应体中匹配的正则表达式，有捕获组时取第一个捕获组
+	Regex string `json:"regex,omitempty"`
+	// Header 响应头名称
+	Header string `json:"header,omitempty"`
+	// Cookie cookie名称，包括本步骤和之前步骤中服务器设置的cookie
+	Cookie string `json:"cookie,omitempty"`
+	// Default 未提取到时使用的值，未设置时提取失败会终止工作流
+	Default *string `json:"default,omitempty"`
+}
+
+// WorkflowResult 工作流的执行结果
+type WorkflowResult struct {
+	Steps []*WorkflowStepResult `json:"steps"`
+	// Vars 工作流结束时的全部变量
+	Vars map[string]string `json:"vars"`
+	// Outcome 工作流的结果分类，由最后执行的步骤决定
+	Outcome    *Outcome `json:"outcome"`
+	DurationMs float64  `json:"duration_ms"`
+}
+
+// WorkflowStepResult 一个步骤的执行结果
+type WorkflowStepResult struct {
+	Name      string            `json:"name"`
+	Result    *CurlResult       `json:"result,omitempty"`
+	Extracted map[string]string `json:"extracted,omitempty"`
+	Outcome   *Outcome          `json:"outcome"`
+}
+
+// Failure 返回工作流失败的原因，成功或已完成时返回nil
+func (r *WorkflowResult) Failure() error {
+	return r.Outcome.Failure()
+}
+
+// WorkflowTask 按顺序执行多个HTTP请求，各步骤共用cookie，
+// 并可以把前面步骤响应中的数据提取为变量传给后面的步骤
+type WorkflowTask struct {
+	Steps []WorkflowStep    `json:"steps" desc:"按顺序执行的步骤"`
+	Vars  map[string]string `json:"vars,omitempty" desc:"工作流的初始变量"`
+}
+
+// Hosts 返回各步骤请求的主机，主机名中包含变量的步骤不计入
+func (t *WorkflowTask) Hosts() []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, step := range t.Steps {
+		var host string
+		if step.Curl != "" {
+			host = curlHost(step.Curl)
+		} else if rawURL, ok := step.Request["url"].(string); ok {
+			host = urlHost(rawURL)
+		}
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// NewWorkflowTask 创建工作流任务，vars为初始变量
+func NewWorkflowTask(steps []WorkflowStep, vars map[string]string) *WorkflowTask {
+	return &WorkflowTask{Steps: steps, Vars: vars}
+}
+
+// Validate 检查工作流的定义
+func (t *WorkflowTask) Validate() error {
+	return t.validate()
+}
+
+// Execute 执行工作流，步骤失败时在结果中返回失败原因
+func (t *WorkflowTask) Execute(ctx context.Context) (*Result, error) {
+	result, err := t.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("执行工作流失败: %v", err)
+	}
+	res := &Result{Data: result, Outcome: result.Outcome}
+	if failure := result.Failure(); failure != nil {
+		res.Failure = fmt.Errorf("工作流执行失败: %v", failure)
+	}
+	return res, nil
+}
+
+// Redacted 返回隐藏了凭据的工作流步骤
+func (t *WorkflowTask) Redacted() string {
+	return RedactWorkflow(t.Steps)
+}
+
+// Run 执行工作流。定义无效时返回错误；步骤失败或已完成（如已签到）时工作流终止，
+// 不再执行后面的步骤，分类和原因记录在结果中。ctx取消时中止当前步骤的请求
+func (t *WorkflowTask) Run(ctx context.Context) (*WorkflowResult, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	vars := make(templateVars, len(t.Vars))
+	for name, value := range t.Vars {
+		vars[name] = value
+	}
+	session := &cookieJar{}
+	// 各步骤读取的密钥，后面步骤的响应中回显了前面步骤的密钥时也要隐藏
+	var resolved []string
+
+	start := time.Now()
+	result := &WorkflowResult{Steps: make([]*WorkflowStepResult, 0, len(t.Steps))}
+	for i := range t.Steps {
+		step := &t.Steps[i]
+		stepResult := &WorkflowStepResult{Name: step.name(i)}
+		result.Steps = append(result.Steps, stepResult)
+
+		stepResult.Outcome = step.run(ctx, vars, session, &resolved, stepResult)
+		stepResult.Outcome.Step = stepResult.Name
+		result.Outcome = stepResult.Outcome
+		if result.Outcome.Status != OutcomeSuccess {
+			break
+		}
+	}
+
+	result.Vars = vars
+	result.DurationMs = roundMillis(time.Since(start))
+	result.maskSecrets(resolved)
+	return result, nil
+}
+
+// maskSecrets 隐藏结果中出现的密钥，包括提取的变量和分类的原因。
+// 执行过程中断言和提取使用原始的响应，工作流结束后才隐藏
+func (r *WorkflowResult) maskSecrets(secrets []string) {
+	if len(secrets) == 0 {
+		return
+	}
+	for _, step := range r.Steps {
+		maskResult(step.Result, secrets)
+		for name, value := range step.Extracted {
+			step.Extracted[name] = maskText(value, secrets)
+		}
+		step.Outcome.Reason = maskText(step.Outcome.Reason, secrets)
+	}
+	for name, value := range r.Vars {
+		r.Vars[name] = maskText(value, secrets)
+	}
+}
+
+// validate 在执行前检查工作流的定义，避免执行了部分步骤后才发现错误
+func (t *WorkflowTask) validate() error {
+	if len(t.Steps) == 0 {
+		return fmt.Errorf("工作流没有步骤")
+	}
+	if len(t.Steps) > maxWorkflowSteps {
+		return fmt.Errorf("工作流最多包含 %d 个步骤", maxWorkflowSteps)
+	}
+	for name := range t.Vars {
+		if err := validVarName(name); err != nil {
+			return err
+		}
+	}
+
+	for i := range t.Steps {
+		step := &t.Steps[i]
+		name := step.name(i)
+		if (step.Curl == "") == (step.Request == nil) {
+			return fmt.Errorf("步骤 %s 必须且只能指定curl或request之一", name)
+		}
+		if step.Curl != "" && !strings.HasPrefix(strings.TrimSpace(step.Curl), "curl") {
+			return fmt.Errorf("步骤 %s 的命令必须以curl开头", name)
+		}
+		for _, e := range step.Extract {
+			if err := e.validate(); err != nil {
+				return fmt.Errorf("步骤 %s: %v", name, err)
+			}
+		}
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("步骤 %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// name 返回步骤名称，未指定时使用从1开始的序号
+func (s *WorkflowStep) name(index int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return strconv.Itoa(index + 1)
+}
+
+// run 渲染并发送请求，按断言分类结果，成功时提取变量。resolved记录各步骤读取的密钥和步骤中的凭据
+func (s *WorkflowStep) run(ctx context.Context, vars templateVars, session *cookieJar, resolved *[]string, stepResult *WorkflowStepResult) *Outcome {
+	failed := func(err error) *Outcome {
+		return &Outcome{Status: OutcomeFailed, Reason: maskError(err, *resolved).Error()}
+	}
+
+	cr, err := s.buildRequest(vars, resolved)
+	if err != nil {
+		return failed(err)
+	}
+	cr.session = session
+	for _, secret := range *resolved {
+		cr.addSecret(secret)
+	}
+	// 步骤自身的凭据（-u的密码、令牌、证书口令等）与密钥一样从错误信息和工作流的结果中隐藏
+	for _, secret := range cr.secrets {
+		if !slices.Contains(*resolved, secret) {
+			*resolved = append(*resolved, secret)
+		}
+	}
+
+	result, err := cr.execute(ctx)
+	if err != nil {
+		return failed(err)
+	}
+	stepResult.Result = result
+
+	outcome := s.Classify(result)
+	if outcome.Status != OutcomeSuccess {
+		return outcome
+	}
+
+	for _, e := range s.Extract {
+		value, err := e.extract(result, session)
+		if err != nil {
+			return failed(err)
+		}
+		if stepResult.Extracted == nil {
+			stepResult.Extracted = make(map[string]string)
+		}
+		stepResult.Extracted[e.Var] = value
+		vars[e.Var] = value
+	}
+	return outcome
+}
+
+// buildRequest 替换变量后解析为curl请求
+func (s *WorkflowStep) buildRequest(vars templateVars, resolved *[]string) (*curlRequest, error) {
+	var args []string
+	if s.Curl != "" {
+		parts, err := splitCurlCommand(strings.TrimSpace(s.Curl))
+		if err != nil {
+			return nil, err
+		}
+		if args, err = vars.renderAll(parts[1:], resolved); err != nil {
+			return nil, err
+		}
+	} else {
+		// 先替换请求对象中的变量再序列化，变量的值会按JSON规则转义
+		rendered, err := vars.renderValue(s.Request, resolved)
+		if err != nil {
+			return nil, err
+		}
+		if args, err = requestArgs(rendered.(map[string]interface{})); err != nil {
+			return nil, err
+		}
+	}
+	return parseCurlArgs(args)
+}
+
+// validate 检查提取规则的定义
+func (e *Extraction) validate() error {
+	if err := validVarName(e.Var); err != nil {
+		return err
+	}
+	sources := 0
+	for _, source := range []string{e.JSON, e.Regex, e.Header, e.Cookie} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("变量 %s 必须且只能指定json、regex、header、cookie之一", e.Var)
+	}
+	if e.JSON != "" {
+		if _, err := parseJSONPath(e.JSON); err != nil {
+			return err
+		}
+	}
+	if e.Regex != "" {
+		if _, err := regexp.Compile(e.Regex); err != nil {
+			return fmt.Errorf("变量 %s 的正则表达式无效: %v", e.Var, err)
+		}
+	}
+	return nil
+}
+
+// extract 从响应中提取变量的值，未找到（包括响应体不是JSON）且没有默认值时返回错误
+func (e *Extraction) extract(result *CurlResult, session *cookieJar) (string, error) {
+	value, found, err := e.find(result, session)
+	if err == nil && found {
+		return value, nil
+	}
+	if e.Default != nil {
+		return *e.Default, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("提取变量 %s 失败: %v", e.Var, err)
+	}
+	return "", fmt.Errorf("提取变量 %s 失败: 响应中没有匹配的内容", e.Var)
+}
+
+func (e *Extraction) find(result *CurlResult, session *cookieJar) (string, bool, error) {
+	switch {
+	case e.JSON != "":
+		doc, err := parseJSONBody(result.Body)
+		if err != nil {
+			return "", false, err
+		}
+		value, found, err := evalJSONPath(doc, e.JSON)
+		if err != nil || !found {
+			return "", false, err
+		}
+		return jsonValueString(value), true, nil
+
+	case e.Regex != "":
+		match := regexp.MustCompile(e.Regex).FindStringSubmatch(result.Body)
+		if match == nil {
+			return "", false, nil
+		}
+		if len(match) > 1 {
+			return match[1], true, nil
+		}
+		return match[0], true, nil
+
+	case e.Header != "":
+		values := http.Header(result.Headers).Values(e.Header)
+		if len(values) == 0 {
+			return "", false, nil
+		}
+		return values[0], true, nil
+
+	default:
+		// 先查找本次响应设置的cookie，再查找会话中保存的cookie
+		for _, c := range (&http.Response{Header: result.Headers}).Cookies() {
+			if c.Name == e.Cookie {
+				return c.Value, true, nil
+			}
+		}
+		u, _ := url.Parse(result.URL)
+		value, found := session.lookup(u, e.Cookie)
+		return value, found, nil
+	}
+}
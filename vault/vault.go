@@ -0,0 +1,386 @@
+// Package vault 提供agent上加密保存的密钥库
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PassphraseEnv 设置了该环境变量时从口令派生加密密钥，否则使用密钥文件
+const PassphraseEnv = "CHECKIN_AGENT_VAULT_PASSPHRASE"
+
+// 加密密钥的来源
+const (
+	kdfKeyFile = "key_file"
+	kdfPBKDF2  = "pbkdf2-sha256"
+)
+
+const (
+	fileVersion      = 1
+	keySize          = 32 // AES-256
+	saltSize         = 16
+	pbkdf2Iterations = 600000
+	maxNameLength    = 64
+	maxValueSize     = 64 << 10
+)
+
+// 加密后写入文件的校验值，用于在读取任何密钥之前发现口令或密钥文件不正确
+const checkPlaintext = "checkin-agent vault"
+
+// 密钥名称只能包含字母、数字和 _ . -
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ErrNotFound 密钥不存在
+var ErrNotFound = errors.New("密钥不存在")
+
+// Vault 加密保存在文件中的密钥库。每个密钥使用AES-256-GCM单独加密，
+// 密钥名称作为附加数据参与认证，密文不能在名称之间交换。
+// 每次操作都重新读取文件，命令行对密钥库的修改不需要重启服务
+type Vault struct {
+	path       string
+	keyFile    string
+	passphrase string
+
+	mu sync.Mutex
+	// 缓存从口令派生的密钥，避免每次读取都重新计算PBKDF2
+	derivedSalt string
+	derivedKey  []byte
+}
+
+// vaultFile 密钥库文件的格式
+type vaultFile struct {
+	Version    int                `json:"version"`
+	KDF        string             `json:"kdf"`
+	Salt       string             `json:"salt,omitempty"`
+	Iterations int                `json:"iterations,omitempty"`
+	Check      *sealed            `json:"check"`
+	Secrets    map[string]*sealed `json:"secrets"`
+}
+
+// sealed 一段加密的数据
+type sealed struct {
+	Nonce string `json:"nonce"`
+	Data  string `json:"data"`
+}
+
+// New 创建密钥库。passphrase不为空时从口令派生密钥，否则使用keyFile中的密钥，
+// 保存第一个密钥时自动生成密钥文件
+func New(path, keyFile, passphrase string) *Vault {
+	return &Vault{path: path, keyFile: keyFile, passphrase: passphrase}
+}
+
+// Get 读取并解密名为name的密钥
+func (v *Vault) Get(name string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f, err := v.load()
+	if err != nil {
+		return "", err
+	}
+	item, ok := f.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	key, err := v.key(f, false)
+	if err != nil {
+		return "", err
+	}
+	value, err := open(key, item, name)
+	if err != nil {
+		return "", fmt.Errorf("解密密钥 %s 失败，密钥库可能已损坏", name)
+	}
+	return string(value), nil
+}
+
+// List 返回所有密钥的名称，不解密密钥的值
+func (v *Vault) List() ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(f.Secrets))
+	for name := range f.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Put 加密保存密钥，同名的密钥会被覆盖
+func (v *Vault) Put(name, value string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("密钥的值不能为空")
+	}
+	if len(value) > maxValueSize {
+		return fmt.Errorf("密钥的值不能超过 %d KB", maxValueSize>>10)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f, err := v.load()
+	if err != nil {
+		return err
+	}
+	key, err := v.key(f, true)
+	if err != nil {
+		return err
+	}
+	item, err := seal(key, []byte(value), name)
+	if err != nil {
+		return err
+	}
+	f.Secrets[name] = item
+	return v.save(f)
+}
+
+// Delete 删除密钥
+func (v *Vault) Delete(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f, err := v.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := f.Secrets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(f.Secrets, name)
+	return v.save(f)
+}
+
+// ValidateName 检查密钥名称
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("密钥名称只能包含字母、数字和 _ . -: %q", name)
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("密钥名称不能超过 %d 个字符", maxNameLength)
+	}
+	return nil
+}
+
+// load 读取密钥库文件，文件不存在时返回空的密钥库
+func (v *Vault) load() (*vaultFile, error) {
+	data, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		return &vaultFile{Version: fileVersion, Secrets: make(map[string]*sealed)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥库失败: %v", err)
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("解析密钥库失败: %v", err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("不支持的密钥库版本: %d", f.Version)
+	}
+	if f.Secrets == nil {
+		f.Secrets = make(map[string]*sealed)
+	}
+	return &f, nil
+}
+
+// save 先写入临时文件再替换，写入中断时不会损坏原有的密钥库
+func (v *Vault) save(f *vaultFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥库失败: %v", err)
+	}
+
+	dir := filepath.Dir(v.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(v.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("写入密钥库失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入密钥库失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入密钥库失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return fmt.Errorf("写入密钥库失败: %v", err)
+	}
+	return nil
+}
+
+// key 返回密钥库的加密密钥并用校验值验证。新的密钥库按当前的配置选择密钥来源，
+// create为true时生成缺少的盐值、校验值和密钥文件
+func (v *Vault) key(f *vaultFile, create bool) ([]byte, error) {
+	if f.KDF == "" {
+		if !create {
+			return nil, fmt.Errorf("密钥库为空")
+		}
+		f.KDF = kdfKeyFile
+		if v.passphrase != "" {
+			salt := make([]byte, saltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+			f.KDF = kdfPBKDF2
+			f.Salt = base64.StdEncoding.EncodeToString(salt)
+			f.Iterations = pbkdf2Iterations
+		}
+	}
+
+	var key []byte
+	var err error
+	switch f.KDF {
+	case kdfKeyFile:
+		key, err = v.readKeyFile(create && f.Check == nil)
+	case kdfPBKDF2:
+		key, err = v.deriveKey(f)
+	default:
+		return nil, fmt.Errorf("不支持的密钥派生方式: %s", f.KDF)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Check == nil {
+		if f.Check, err = seal(key, []byte(checkPlaintext), ""); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if check, err := open(key, f.Check, ""); err != nil || string(check) != checkPlaintext {
+		if f.KDF == kdfPBKDF2 {
+			return nil, fmt.Errorf("密钥库的口令不正确")
+		}
+		return nil, fmt.Errorf("密钥文件与密钥库不匹配: %s", v.keyFile)
+	}
+	return key, nil
+}
+
+// readKeyFile 读取十六进制编码的密钥文件，create为true且文件不存在时生成新的密钥
+func (v *Vault) readKeyFile(create bool) ([]byte, error) {
+	data, err := os.ReadFile(v.keyFile)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(v.keyFile), 0700); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %v", err)
+		}
+		// O_EXCL避免覆盖同时生成的另一个密钥文件
+		file, err := os.OpenFile(v.keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("创建密钥文件失败: %v", err)
+		}
+		_, err = file.WriteString(hex.EncodeToString(key) + "\n")
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("写入密钥文件失败: %v", err)
+		}
+		return key, nil
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("密钥文件不存在: %s", v.keyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("密钥文件格式无效: %s", v.keyFile)
+	}
+	return key, nil
+}
+
+// deriveKey 用PBKDF2从口令派生密钥
+func (v *Vault) deriveKey(f *vaultFile) ([]byte, error) {
+	if v.passphrase == "" {
+		return nil, fmt.Errorf("密钥库使用口令加密，需要设置环境变量 %s", PassphraseEnv)
+	}
+	if v.derivedKey != nil && v.derivedSalt == f.Salt {
+		return v.derivedKey, nil
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(f.Salt)
+	if err != nil || len(salt) == 0 || f.Iterations <= 0 {
+		return nil, fmt.Errorf("密钥库的派生参数无效")
+	}
+	key, err := pbkdf2.Key(sha256.New, v.passphrase, salt, f.Iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %v", err)
+	}
+	v.derivedSalt, v.derivedKey = f.Salt, key
+	return key, nil
+}
+
+// seal 使用AES-256-GCM加密，name作为附加数据
+func seal(key, plaintext []byte, name string) (*sealed, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	data := aead.Seal(nil, nonce, plaintext, []byte(name))
+	return &sealed{
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+		Data:  base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+// open 解密并验证seal的结果
+func open(key []byte, item *sealed, name string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(item.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("无效的nonce")
+	}
+	data, err := base64.StdEncoding.DecodeString(item.Data)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, data, []byte(name))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}